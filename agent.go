@@ -0,0 +1,79 @@
+package dialogflow
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// defaultConcurrency is the number of requests in flight when loading a whole agent
+const defaultConcurrency = 4
+
+// Agent holds the full content of an agent, intents and entities included
+type Agent struct {
+	Intents  []model.Intent `json:"intents,omitempty"`
+	Entities []model.Entity `json:"entities,omitempty"`
+}
+
+// Intent returns the intent named name
+func (agent Agent) Intent(name string) (model.Intent, bool) {
+	for _, intent := range agent.Intents {
+		if intent.Name == name {
+			return intent, true
+		}
+	}
+	return model.Intent{}, false
+}
+
+// Entity returns the entity named name
+func (agent Agent) Entity(name string) (model.Entity, bool) {
+	for _, entity := range agent.Entities {
+		if entity.Name == name {
+			return entity, true
+		}
+	}
+	return model.Entity{}, false
+}
+
+// LoadAgent fetches every intent and entity of the agent with all their details,
+// with at most concurrency requests in flight
+func (client *Client) LoadAgent(concurrency int) (Agent, error) {
+	var agent Agent
+
+	intents, err := client.GetIntents(nil, concurrency)
+	if err != nil {
+		return agent, err
+	}
+	agent.Intents = intents
+
+	entities, err := client.GetAllEntities()
+	if err != nil {
+		return agent, err
+	}
+
+	for _, summary := range entities {
+		entity, err := client.GetEntity(summary.ID)
+		if err != nil {
+			return agent, err
+		}
+		agent.Entities = append(agent.Entities, entity)
+	}
+
+	return agent, nil
+}
+
+// ReadAgent decodes an agent exported with WriteAgent
+// Use ReadAgentExport for the export zips of the Dialogflow console
+func ReadAgent(r io.Reader) (Agent, error) {
+	var agent Agent
+	err := json.NewDecoder(r).Decode(&agent)
+	return agent, err
+}
+
+// WriteAgent encodes agent as indented JSON
+func WriteAgent(w io.Writer, agent Agent) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(agent)
+}
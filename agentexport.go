@@ -0,0 +1,259 @@
+package dialogflow
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// exportLanguageFile matches the per language files of an export, e.g. book_usersays_en.json
+var exportLanguageFile = regexp.MustCompile(`^(.+)_(usersays|entries)_([A-Za-z-]+)\.json$`)
+
+// exportAgent is the agent.json of an export
+type exportAgent struct {
+	Language string `json:"language"`
+}
+
+// exportIntent is an intent as written by the Dialogflow console, whose responses
+// differ from those of the API
+type exportIntent struct {
+	model.Intent
+	Responses []exportResponse `json:"responses"`
+}
+
+type exportResponse struct {
+	Action           string            `json:"action"`
+	ResetContexts    bool              `json:"resetContexts"`
+	AffectedContexts []model.Context   `json:"affectedContexts"`
+	Parameters       []exportParameter `json:"parameters"`
+	Messages         []exportMessage   `json:"messages"`
+}
+
+// exportParameter has prompts that are either strings or objects with a language
+type exportParameter struct {
+	Name         string            `json:"name"`
+	Value        string            `json:"value"`
+	DefaultValue string            `json:"defaultValue"`
+	Required     bool              `json:"required"`
+	DataType     string            `json:"dataType"`
+	IsList       bool              `json:"isList"`
+	Prompts      []json.RawMessage `json:"prompts"`
+}
+
+// exportMessage has a type that is a number, a quoted number or a name,
+// and speech that is either a string or a list of variants
+type exportMessage struct {
+	Type     json.RawMessage        `json:"type"`
+	Lang     string                 `json:"lang"`
+	Platform string                 `json:"platform"`
+	Speech   json.RawMessage        `json:"speech"`
+	Title    string                 `json:"title"`
+	Subtitle string                 `json:"subtitle"`
+	ImageURL string                 `json:"imageUrl"`
+	Buttons  []model.Button         `json:"buttons"`
+	Replies  []string               `json:"replies"`
+	Payload  map[string]interface{} `json:"payload"`
+}
+
+// ReadAgentExport reads an agent export zip downloaded from the Dialogflow console,
+// with its intents/*.json and entities/*.json files
+// Training phrases, entries, responses and prompts are read in lang, or in the agent's
+// default language if lang is empty
+func ReadAgentExport(r io.ReaderAt, size int64, lang string) (Agent, error) {
+	var agent Agent
+
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return agent, err
+	}
+
+	files := make(map[string]*zip.File)
+	var settingsFile *zip.File
+	for _, file := range archive.File {
+		dir, name := path.Split(file.Name)
+		// Some exports nest everything in a folder named after the agent
+		files[path.Join(path.Base(dir), name)] = file
+		if name == "agent.json" {
+			settingsFile = file
+		}
+	}
+
+	if lang == "" {
+		lang = "en"
+		if settingsFile != nil {
+			var settings exportAgent
+			if err := readExportFile(settingsFile, &settings); err != nil {
+				return agent, err
+			}
+			if settings.Language != "" {
+				lang = settings.Language
+			}
+		}
+	}
+
+	var names []string
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		dir, base := path.Split(name)
+		if path.Ext(base) != ".json" || exportLanguageFile.MatchString(base) {
+			continue
+		}
+		stem := strings.TrimSuffix(base, ".json")
+
+		switch dir {
+		case "intents/":
+			var exported exportIntent
+			if err := readExportFile(files[name], &exported); err != nil {
+				return agent, err
+			}
+			intent := exported.toIntent(lang)
+
+			if file, ok := files["intents/"+stem+"_usersays_"+lang+".json"]; ok {
+				if err := readExportFile(file, &intent.UserSays); err != nil {
+					return agent, err
+				}
+			}
+			agent.Intents = append(agent.Intents, intent)
+
+		case "entities/":
+			var entity model.Entity
+			if err := readExportFile(files[name], &entity); err != nil {
+				return agent, err
+			}
+
+			if file, ok := files["entities/"+stem+"_entries_"+lang+".json"]; ok {
+				if err := readExportFile(file, &entity.Entries); err != nil {
+					return agent, err
+				}
+			}
+			agent.Entities = append(agent.Entities, entity)
+		}
+	}
+
+	if len(agent.Intents) == 0 && len(agent.Entities) == 0 {
+		return agent, fmt.Errorf("export has no intents or entities")
+	}
+
+	return agent, nil
+}
+
+func readExportFile(file *zip.File, v interface{}) error {
+	reader, err := file.Open()
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if err := json.NewDecoder(skipBOM(reader)).Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", file.Name, err)
+	}
+	return nil
+}
+
+// toIntent converts the intent, keeping the messages and prompts in lang
+func (exported exportIntent) toIntent(lang string) model.Intent {
+	intent := exported.Intent
+	intent.Responses = nil
+
+	for _, response := range exported.Responses {
+		converted := model.Response{
+			Action:           response.Action,
+			ResetContexts:    response.ResetContexts,
+			AffectedContexts: response.AffectedContexts,
+		}
+
+		for _, parameter := range response.Parameters {
+			converted.Parameters = append(converted.Parameters, parameter.toParameter(lang))
+		}
+
+		for _, message := range response.Messages {
+			if message.Lang == "" || message.Lang == lang {
+				converted.Messages = append(converted.Messages, message.toMessages()...)
+			}
+		}
+
+		intent.Responses = append(intent.Responses, converted)
+	}
+
+	return intent
+}
+
+func (parameter exportParameter) toParameter(lang string) model.Parameter {
+	converted := model.Parameter{
+		Name:         parameter.Name,
+		Value:        parameter.Value,
+		DefaultValue: parameter.DefaultValue,
+		Required:     parameter.Required,
+		DataType:     parameter.DataType,
+		IsList:       parameter.IsList,
+	}
+
+	for _, raw := range parameter.Prompts {
+		var prompt struct {
+			Lang  string `json:"lang"`
+			Value string `json:"value"`
+		}
+		if json.Unmarshal(raw, &prompt.Value) != nil && json.Unmarshal(raw, &prompt) != nil {
+			continue
+		}
+		if prompt.Value != "" && (prompt.Lang == "" || prompt.Lang == lang) {
+			converted.Prompts = append(converted.Prompts, prompt.Value)
+		}
+	}
+
+	return converted
+}
+
+// toMessages converts the message, with one text message per speech variant
+// Messages of types the model does not know, e.g. Actions on Google ones, become payloads
+func (message exportMessage) toMessages() []model.Message {
+	converted := model.Message{
+		Type:     model.PayloadMessage,
+		Platform: message.Platform,
+		Title:    message.Title,
+		Subtitle: message.Subtitle,
+		ImageURL: message.ImageURL,
+		Buttons:  message.Buttons,
+		Replies:  message.Replies,
+		Payload:  message.Payload,
+	}
+
+	var kind string
+	if json.Unmarshal(message.Type, &kind) != nil {
+		kind = string(message.Type)
+	}
+	if n, err := strconv.Atoi(kind); err == nil && n >= model.TextMessage && n <= model.PayloadMessage {
+		converted.Type = n
+	}
+
+	if converted.Type != model.TextMessage {
+		return []model.Message{converted}
+	}
+
+	var variants []string
+	if json.Unmarshal(message.Speech, &variants) != nil {
+		var speech string
+		json.Unmarshal(message.Speech, &speech)
+		variants = []string{speech}
+	}
+
+	var messages []model.Message
+	for _, speech := range variants {
+		text := converted
+		text.Speech = speech
+		messages = append(messages, text)
+	}
+	return messages
+}
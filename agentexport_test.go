@@ -0,0 +1,146 @@
+package dialogflow
+
+import (
+	"archive/zip"
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// exportFiles is a console export of an agent in German and English, nested in a folder
+var exportFiles = map[string]string{
+	"pizza/agent.json": `{"language": "de", "supportedLanguages": ["en"]}`,
+	"pizza/intents/order.json": `{
+		"name": "order",
+		"auto": true,
+		"responses": [{
+			"action": "order.pizza",
+			"affectedContexts": [{"name": "ordering", "lifespan": 2}],
+			"parameters": [{
+				"name": "size",
+				"dataType": "@size",
+				"value": "$size",
+				"required": true,
+				"prompts": [{"lang": "en", "value": "What size?"}, {"lang": "de", "value": "Welche Größe?"}]
+			}],
+			"messages": [
+				{"type": 0, "lang": "en", "speech": ["Coming up", "On its way"]},
+				{"type": 0, "lang": "de", "speech": "Kommt sofort"},
+				{"type": "simple_response", "platform": "google", "lang": "en", "textToSpeech": "Coming up"}
+			]
+		}]
+	}`,
+	"pizza/intents/order_usersays_en.json": `[{"data": [{"text": "a "}, {"text": "large", "meta": "@size", "alias": "size", "userDefined": true}, {"text": " pizza"}]}]`,
+	"pizza/intents/order_usersays_de.json": `[{"data": [{"text": "eine große Pizza"}]}]`,
+	"pizza/entities/size.json":             `{"name": "size", "isEnum": false}`,
+	"pizza/entities/size_entries_en.json":  "\ufeff" + `[{"value": "large", "synonyms": ["large", "big"]}]`,
+	"pizza/entities/size_entries_de.json":  `[{"value": "groß", "synonyms": ["groß"]}]`,
+	"pizza/package.json":                   `{"version": "1.0.0"}`,
+}
+
+// exportZip zips files and returns a reader over the archive and its size
+func exportZip(t *testing.T, files map[string]string) (*bytes.Reader, int64) {
+	var buffer bytes.Buffer
+	writer := zip.NewWriter(&buffer)
+	for name, content := range files {
+		file, err := writer.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		file.Write([]byte(content))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(buffer.Bytes()), int64(buffer.Len())
+}
+
+func TestReadAgentExport(t *testing.T) {
+	r, size := exportZip(t, exportFiles)
+
+	agent, err := ReadAgentExport(r, size, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := Agent{
+		Intents: []model.Intent{{
+			Name: "order",
+			Auto: true,
+			UserSays: []model.UserSay{{Data: []model.Data{
+				{Text: "a "},
+				{Text: "large", Meta: "@size", Alias: "size", UserDefined: true},
+				{Text: " pizza"},
+			}}},
+			Responses: []model.Response{{
+				Action:           "order.pizza",
+				AffectedContexts: []model.Context{{Name: "ordering", Lifespan: 2}},
+				Parameters: []model.Parameter{{
+					Name:     "size",
+					DataType: "@size",
+					Value:    "$size",
+					Required: true,
+					Prompts:  []string{"What size?"},
+				}},
+				Messages: []model.Message{
+					{Type: model.TextMessage, Speech: "Coming up"},
+					{Type: model.TextMessage, Speech: "On its way"},
+					{Type: model.PayloadMessage, Platform: "google"},
+				},
+			}},
+		}},
+		Entities: []model.Entity{{
+			Name:    "size",
+			Entries: []model.Entry{{Value: "large", Synonyms: []string{"large", "big"}}},
+		}},
+	}
+	if !reflect.DeepEqual(agent, want) {
+		t.Errorf("got %+v\nwant %+v", agent, want)
+	}
+
+	// The default language comes from agent.json
+	agent, err = ReadAgentExport(r, size, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	intent := agent.Intents[0]
+	if got := FormatUserSay(intent.UserSays[0]); got != "eine große Pizza" {
+		t.Errorf("de: got phrase %q", got)
+	}
+	if got := intent.Responses[0].Parameters[0].Prompts; !reflect.DeepEqual(got, []string{"Welche Größe?"}) {
+		t.Errorf("de: got prompts %q", got)
+	}
+	if got := intent.Responses[0].Messages; !reflect.DeepEqual(got, []model.Message{{Type: model.TextMessage, Speech: "Kommt sofort"}}) {
+		t.Errorf("de: got messages %+v", got)
+	}
+	if got := agent.Entities[0].Entries[0].Value; got != "groß" {
+		t.Errorf("de: got entry %q", got)
+	}
+}
+
+func TestReadAgentExportErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+	}{
+		{"no intents or entities", map[string]string{"agent.json": `{"language": "en"}`}},
+		{"malformed intent", map[string]string{"intents/order.json": `{"name":`}},
+		{"malformed entries", map[string]string{
+			"entities/size.json":            `{"name": "size"}`,
+			"entities/size_entries_en.json": `{"value": "large"}`,
+		}},
+	}
+
+	for _, test := range tests {
+		r, size := exportZip(t, test.files)
+		if _, err := ReadAgentExport(r, size, ""); err == nil {
+			t.Errorf("%s: got no error", test.name)
+		}
+	}
+
+	if _, err := ReadAgentExport(bytes.NewReader([]byte("not a zip")), 9, ""); err == nil {
+		t.Errorf("not a zip: got no error")
+	}
+}
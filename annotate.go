@@ -0,0 +1,240 @@
+package dialogflow
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// diacritics maps accented lower case Latin letters to their base letter
+var diacritics = func() map[rune]rune {
+	table := map[rune]string{
+		'a': "àáâãäåāăą",
+		'c': "çćĉċč",
+		'd': "ďđ",
+		'e': "èéêëēĕėęě",
+		'g': "ĝğġģ",
+		'h': "ĥħ",
+		'i': "ìíîïĩīĭįı",
+		'j': "ĵ",
+		'k': "ķ",
+		'l': "ĺļľŀł",
+		'n': "ñńņňŉ",
+		'o': "òóôõöøōŏő",
+		'r': "ŕŗř",
+		's': "śŝşšș",
+		't': "ţťŧț",
+		'u': "ùúûüũūŭůűų",
+		'w': "ŵ",
+		'y': "ýÿŷ",
+		'z': "źżž",
+	}
+
+	folded := make(map[rune]rune)
+	for base, accented := range table {
+		for _, r := range accented {
+			folded[r] = base
+		}
+	}
+	return folded
+}()
+
+// foldRune lower cases r and strips its diacritics
+func foldRune(r rune) rune {
+	r = unicode.ToLower(r)
+	if base, ok := diacritics[r]; ok {
+		return base
+	}
+	return r
+}
+
+// foldString folds every rune of s, keeping one rune per input rune
+func foldString(s string) []rune {
+	folded := make([]rune, 0, len(s))
+	for _, r := range s {
+		folded = append(folded, foldRune(r))
+	}
+	return folded
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// Ambiguity is text that matched synonyms of several entities, or overlapping synonyms
+// of the same length, and was left unannotated
+type Ambiguity struct {
+	Text string
+	// Offset is the position of Text in the annotated phrase, in bytes
+	Offset int
+	// Entities are the names of the candidate entities
+	Entities []string
+}
+
+type annotatorSynonym struct {
+	runes  []rune
+	entity string
+}
+
+// Annotator finds entity synonyms in plain text
+type Annotator struct {
+	synonyms map[rune][]annotatorSynonym
+}
+
+// NewAnnotator creates an annotator matching the synonyms of the entries of entities
+func NewAnnotator(entities []model.Entity) *Annotator {
+	annotator := &Annotator{synonyms: make(map[rune][]annotatorSynonym)}
+
+	for _, entity := range entities {
+		seen := make(map[string]bool)
+		for _, entry := range entity.Entries {
+			for _, synonym := range append([]string{entry.Value}, entry.Synonyms...) {
+				runes := foldString(strings.TrimSpace(synonym))
+				if len(runes) == 0 || seen[string(runes)] || strings.Contains(synonym, "@") {
+					continue
+				}
+				seen[string(runes)] = true
+				annotator.synonyms[runes[0]] = append(annotator.synonyms[runes[0]], annotatorSynonym{runes: runes, entity: entity.Name})
+			}
+		}
+	}
+
+	return annotator
+}
+
+// span is a run of runes [start, end) matching synonyms of one or more entities
+type span struct {
+	start, end int
+	entities   []string
+	ambiguous  bool
+}
+
+func (s *span) overlaps(other *span) bool {
+	return s.start < other.end && other.start < s.end
+}
+
+// Annotate splits text into segments, annotating the longest synonym matches with the entity
+// they belong to, as @entity with the entity name as alias
+// Matching ignores case and diacritics and only considers whole words
+// Matches that are ambiguous are left as plain text and reported
+func (annotator *Annotator) Annotate(text string) (model.UserSay, []Ambiguity) {
+	folded := foldString(text)
+
+	// offsets[i] is the byte offset of rune i, with a final entry for the end of text
+	offsets := make([]int, 0, len(folded)+1)
+	for i := range text {
+		offsets = append(offsets, i)
+	}
+	offsets = append(offsets, len(text))
+
+	spans := make(map[[2]int]*span)
+	for start, r := range folded {
+		if start > 0 && isWordRune(folded[start-1]) {
+			continue
+		}
+
+		for _, synonym := range annotator.synonyms[r] {
+			end := start + len(synonym.runes)
+			if end > len(folded) || (end < len(folded) && isWordRune(folded[end])) {
+				continue
+			}
+			if string(folded[start:end]) != string(synonym.runes) {
+				continue
+			}
+
+			key := [2]int{start, end}
+			if spans[key] == nil {
+				spans[key] = &span{start: start, end: end}
+			}
+			if !containsString(spans[key].entities, synonym.entity) {
+				spans[key].entities = append(spans[key].entities, synonym.entity)
+			}
+		}
+	}
+
+	candidates := make([]*span, 0, len(spans))
+	for _, s := range spans {
+		candidates = append(candidates, s)
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.end-a.start != b.end-b.start {
+			return a.end-a.start > b.end-b.start
+		}
+		return a.start < b.start
+	})
+
+	var taken []*span
+	for _, candidate := range candidates {
+		candidate.ambiguous = len(candidate.entities) > 1
+		shadowed := false
+
+		for _, other := range taken {
+			if !candidate.overlaps(other) {
+				continue
+			}
+			if other.end-other.start > candidate.end-candidate.start {
+				shadowed = true
+				break
+			}
+			other.ambiguous, candidate.ambiguous = true, true
+		}
+
+		if !shadowed {
+			taken = append(taken, candidate)
+		}
+	}
+
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[i].start < taken[j].start
+	})
+
+	var userSay model.UserSay
+	var ambiguities []Ambiguity
+	cursor := 0
+
+	for _, s := range taken {
+		if s.ambiguous {
+			// A text matched by several overlapping ambiguous spans is reported once
+			if n := len(ambiguities); n > 0 && ambiguities[n-1].Offset+len(ambiguities[n-1].Text) > offsets[s.start] {
+				last := &ambiguities[n-1]
+				last.Text = text[last.Offset:max(offsets[s.end], last.Offset+len(last.Text))]
+				for _, entity := range s.entities {
+					if !containsString(last.Entities, entity) {
+						last.Entities = append(last.Entities, entity)
+					}
+				}
+				continue
+			}
+
+			ambiguities = append(ambiguities, Ambiguity{
+				Text:     text[offsets[s.start]:offsets[s.end]],
+				Offset:   offsets[s.start],
+				Entities: append([]string(nil), s.entities...),
+			})
+			continue
+		}
+
+		if s.start > cursor {
+			userSay.Data = append(userSay.Data, model.Data{Text: text[offsets[cursor]:offsets[s.start]]})
+		}
+		userSay.Data = append(userSay.Data, model.Data{
+			Text:  text[offsets[s.start]:offsets[s.end]],
+			Meta:  "@" + s.entities[0],
+			Alias: s.entities[0],
+		})
+		cursor = s.end
+	}
+
+	if cursor < len(folded) {
+		userSay.Data = append(userSay.Data, model.Data{Text: text[offsets[cursor]:]})
+	}
+
+	for i := range ambiguities {
+		sort.Strings(ambiguities[i].Entities)
+	}
+
+	return userSay, ambiguities
+}
@@ -0,0 +1,146 @@
+package dialogflow
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// AuditEntry describes a single create, update or delete issued through a client
+type AuditEntry struct {
+	Time       time.Time       `json:"time"`
+	Actor      string          `json:"actor,omitempty"`
+	Operation  string          `json:"operation"`
+	ResourceID string          `json:"resourceId,omitempty"`
+	SessionID  string          `json:"sessionId,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+	Status     model.Status    `json:"status"`
+	Error      string          `json:"error,omitempty"`
+}
+
+// AuditSink receives audit entries
+type AuditSink interface {
+	Record(entry AuditEntry) error
+}
+
+// MemoryAuditSink keeps audit entries in memory
+type MemoryAuditSink struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+// NewMemoryAuditSink creates an empty in-memory audit sink
+func NewMemoryAuditSink() *MemoryAuditSink {
+	return &MemoryAuditSink{}
+}
+
+// Record appends entry to the sink
+func (sink *MemoryAuditSink) Record(entry AuditEntry) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	sink.entries = append(sink.entries, entry)
+	return nil
+}
+
+// Entries returns the recorded entries, oldest first
+func (sink *MemoryAuditSink) Entries() []AuditEntry {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	entries := make([]AuditEntry, len(sink.entries))
+	copy(entries, sink.entries)
+	return entries
+}
+
+// JSONLAuditSink writes audit entries as JSON lines
+type JSONLAuditSink struct {
+	mu      sync.Mutex
+	w       io.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONLAuditSink creates an audit sink writing one JSON object per line to w
+func NewJSONLAuditSink(w io.Writer) *JSONLAuditSink {
+	return &JSONLAuditSink{w: w, encoder: json.NewEncoder(w)}
+}
+
+// OpenJSONLAuditSink creates an audit sink appending to the file at path
+func OpenJSONLAuditSink(path string) (*JSONLAuditSink, error) {
+	if path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewJSONLAuditSink(file), nil
+}
+
+// Record writes entry as a single line
+func (sink *JSONLAuditSink) Record(entry AuditEntry) error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	return sink.encoder.Encode(entry)
+}
+
+// Close closes the underlying writer if it is closable
+func (sink *JSONLAuditSink) Close() error {
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+
+	if closer, ok := sink.w.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// audit records the outcome of a sent mutation to the client's audit sink
+// Failing to record does not fail the mutation, which has already happened
+func (r *request) audit(data []byte, sendErr error) {
+	sink, actor := r.client.GetAuditSink(), r.client.GetActor()
+	if sink == nil {
+		return
+	}
+
+	var response struct {
+		ID     string       `json:"id"`
+		Status model.Status `json:"status"`
+	}
+
+	entry := AuditEntry{
+		Time:       time.Now(),
+		Actor:      actor,
+		Operation:  r.operation,
+		ResourceID: PlanStep{Path: r.path}.ResourceID(),
+		SessionID:  r.sessionID,
+	}
+
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+	} else if err := json.Unmarshal(data, &response); err != nil {
+		entry.Error = err.Error()
+	}
+	entry.Status = response.Status
+
+	if entry.ResourceID == "" && strings.HasPrefix(r.operation, "Create") {
+		entry.ResourceID = response.ID
+	}
+
+	body, err := r.encodedBody()
+	if err == nil {
+		entry.Body = body
+	}
+
+	if err := sink.Record(entry); err != nil {
+		log.Printf("dialogflow: could not record audit entry for %s: %v", r.operation, err)
+	}
+}
@@ -1,5 +1,7 @@
 package dialogflow
 
+import "sync"
+
 // Client is a DialogFlow client
 type Client struct {
 	accessToken string
@@ -7,6 +9,15 @@ type Client struct {
 	apiBaseURL  string
 	apiLang     string
 	sessionID   string
+
+	mu        sync.Mutex
+	dryRun    bool
+	plan      Plan
+	snapshots SnapshotStore
+	auditSink AuditSink
+	actor     string
+	index     nameIndex
+	limiter   rateLimiter
 }
 
 // GetProtocol returns client protocol
@@ -28,3 +39,31 @@ func (client *Client) GetBaseURL() string {
 func (client *Client) GetAccessToken() string {
 	return client.accessToken
 }
+
+// IsDryRun reports whether the client records mutations instead of sending them
+func (client *Client) IsDryRun() bool {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.dryRun
+}
+
+// GetSnapshotStore returns the store that receives pre-mutation snapshots, if any
+func (client *Client) GetSnapshotStore() SnapshotStore {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.snapshots
+}
+
+// GetAuditSink returns the sink that receives audit entries, if any
+func (client *Client) GetAuditSink() AuditSink {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.auditSink
+}
+
+// GetActor returns the actor recorded in audit entries
+func (client *Client) GetActor() string {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	return client.actor
+}
@@ -0,0 +1,110 @@
+// Command dialogflow-lint checks an agent for common design problems
+//
+// It reads the agent from a file written by dialogflow.WriteAgent, from a .zip export
+// downloaded from the Dialogflow console or from the API, prints the findings and exits
+// with status 1 if any reaches the failing severity
+//
+//	dialogflow-lint -agent agent.json -disable min-training-phrases
+//	dialogflow-lint -agent export.zip -lang de
+//	DIALOGFLOW_TOKEN=... dialogflow-lint -json
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	dialogflow "github.com/kompiuter/go-dialogflow"
+)
+
+func main() {
+	var (
+		agentFile  = flag.String("agent", "", "agent file written by dialogflow.WriteAgent or .zip console export; the agent of $DIALOGFLOW_TOKEN if empty")
+		lang       = flag.String("lang", "", "language to read from a console export; the agent's default language if empty")
+		disable    = flag.String("disable", "", "comma separated rules to disable")
+		minPhrases = flag.Int("min-phrases", 5, "fewest training phrases an intent may have")
+		failOn     = flag.String("fail-on", "error", "lowest severity that fails the run")
+		asJSON     = flag.Bool("json", false, "print findings as JSON")
+		listRules  = flag.Bool("rules", false, "list the available rules and exit")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *listRules {
+		for _, rule := range dialogflow.LintRules {
+			fmt.Printf("%-32s %s\n", rule.Name, rule.Severity)
+		}
+		return
+	}
+
+	var threshold dialogflow.Severity
+	if err := threshold.UnmarshalText([]byte(*failOn)); err != nil {
+		log.Fatal(err)
+	}
+
+	agent, err := loadAgent(*agentFile, *lang)
+	if err != nil {
+		log.Fatalf("could not load agent: %v", err)
+	}
+
+	config := dialogflow.LintConfig{
+		Disabled:           make(map[string]bool),
+		MinTrainingPhrases: *minPhrases,
+	}
+	for _, rule := range strings.Split(*disable, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			config.Disabled[rule] = true
+		}
+	}
+
+	findings := dialogflow.Lint(agent, config)
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(findings); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		for _, finding := range findings {
+			fmt.Println(finding)
+		}
+	}
+
+	if max, ok := dialogflow.MaxSeverity(findings); ok && max >= threshold {
+		os.Exit(1)
+	}
+}
+
+func loadAgent(path, lang string) (dialogflow.Agent, error) {
+	if path == "" {
+		token := os.Getenv("DIALOGFLOW_TOKEN")
+		if token == "" {
+			return dialogflow.Agent{}, fmt.Errorf("either -agent or $DIALOGFLOW_TOKEN is required")
+		}
+		return dialogflow.NewClient(token).LoadAgent(8)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return dialogflow.Agent{}, err
+	}
+	defer file.Close()
+
+	if strings.HasSuffix(strings.ToLower(path), ".zip") {
+		info, err := file.Stat()
+		if err != nil {
+			return dialogflow.Agent{}, err
+		}
+		return dialogflow.ReadAgentExport(file, info.Size(), lang)
+	}
+
+	agent, err := dialogflow.ReadAgent(file)
+	if err == nil && len(agent.Intents) == 0 && len(agent.Entities) == 0 {
+		err = fmt.Errorf("%s has no intents or entities, only files written by dialogflow.WriteAgent and .zip console exports are supported", path)
+	}
+	return agent, err
+}
@@ -0,0 +1,90 @@
+// Command dialogflow-replay replays webhook exchanges recorded by webhook.Record against a
+// running webhook and reports the responses that changed
+//
+// It exits with status 1 if any response differs from the recorded one
+//
+//	dialogflow-replay -file yesterday.jsonl -url http://localhost:8080/webhook
+//	dialogflow-replay -file yesterday.jsonl -url ... -ignore data.google.conversationToken
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/webhook"
+)
+
+func main() {
+	var (
+		file    = flag.String("file", "", "JSONL file of recorded exchanges")
+		url     = flag.String("url", "", "URL of the webhook to replay against")
+		ignore  = flag.String("ignore", "", "comma separated response paths to leave out of comparisons")
+		headers = flag.String("header", "", "comma separated Name:value headers to send, e.g. for authentication")
+		timeout = flag.Duration("timeout", 10*time.Second, "timeout of every request")
+		verbose = flag.Bool("v", false, "print unchanged exchanges too")
+	)
+	flag.Parse()
+	log.SetFlags(0)
+
+	if *file == "" || *url == "" {
+		log.Fatal("-file and -url are required")
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	exchanges, err := webhook.ReadExchanges(input)
+	input.Close()
+	if err != nil {
+		log.Fatalf("could not read exchanges: %v", err)
+	}
+
+	remote := &webhook.RemoteHandler{
+		URL:    *url,
+		Client: &http.Client{Timeout: *timeout},
+		Header: make(http.Header),
+	}
+	for _, header := range strings.Split(*headers, ",") {
+		if name, value, ok := strings.Cut(header, ":"); ok {
+			remote.Header.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+		}
+	}
+
+	var ignored []string
+	for _, path := range strings.Split(*ignore, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			ignored = append(ignored, path)
+		}
+	}
+
+	changed := 0
+	for i, result := range webhook.Replay(context.Background(), remote, exchanges, ignored...) {
+		request := result.Exchange.Request
+		label := fmt.Sprintf("#%d session %s action %q", i+1, request.SessionID, request.Result.Action)
+
+		if len(result.Differences) == 0 {
+			if *verbose {
+				fmt.Printf("ok       %s\n", label)
+			}
+			continue
+		}
+
+		changed++
+		fmt.Printf("changed  %s\n", label)
+		for _, difference := range result.Differences {
+			fmt.Printf("    %s\n", difference)
+		}
+	}
+
+	fmt.Printf("%d of %d responses changed\n", changed, len(exchanges))
+	if changed > 0 {
+		os.Exit(1)
+	}
+}
@@ -71,6 +71,7 @@ func (client *Client) AddContexts(session string, contexts []model.Context) (mod
 	request := newRequest(
 		client,
 		requestOptions{
+			Operation: "AddContexts",
 			Path:      contextEndpoint,
 			SessionID: session,
 			Method:    http.MethodPost,
@@ -93,6 +94,7 @@ func (client *Client) DeleteAllContexts(session string) (model.QueryResponse, er
 	request := newRequest(
 		client,
 		requestOptions{
+			Operation: "DeleteAllContexts",
 			Path:      contextEndpoint,
 			SessionID: session,
 			Method:    http.MethodDelete,
@@ -119,6 +121,7 @@ func (client *Client) DeleteContext(session, ctx string) (model.QueryResponse, e
 	request := newRequest(
 		client,
 		requestOptions{
+			Operation: "DeleteContext",
 			Path:      fmt.Sprintf("%s/%s", contextEndpoint, ctx),
 			SessionID: session,
 			Method:    http.MethodDelete,
@@ -0,0 +1,178 @@
+package dialogflow
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// entityReference matches references to entities in composite entity entries, e.g. @sys.number:amount
+var entityReference = regexp.MustCompile(`@([A-Za-z0-9_.-]+)(?::[A-Za-z0-9_-]+)?`)
+
+// Reference is a place where an intent or entity refers to an entity
+type Reference struct {
+	// Kind is either "intent" or "entity"
+	Kind string
+	ID   string
+	Name string
+	// Via describes the referencing element: "training phrase", "parameter" or "composite entry"
+	Via string
+}
+
+func (ref Reference) String() string {
+	return fmt.Sprintf("%s %q (%s)", ref.Kind, ref.Name, ref.Via)
+}
+
+// DependencyGraph records which intents and entities refer to which entities
+// Entities are identified by name without the leading @, system entities included
+type DependencyGraph struct {
+	users map[string][]Reference
+	needs map[string][]string
+}
+
+// BuildDependencyGraph analyses the training phrase annotations and parameters of every intent,
+// and the entries of every composite entity of agent
+func BuildDependencyGraph(agent Agent) *DependencyGraph {
+	graph := &DependencyGraph{
+		users: make(map[string][]Reference),
+		needs: make(map[string][]string),
+	}
+
+	for _, intent := range agent.Intents {
+		from := Reference{Kind: "intent", ID: intent.ID, Name: intent.Name}
+
+		for _, userSay := range intent.UserSays {
+			for _, data := range userSay.Data {
+				if strings.HasPrefix(data.Meta, "@") {
+					graph.add(from, "training phrase", strings.TrimPrefix(data.Meta, "@"))
+				}
+			}
+		}
+
+		for _, response := range intent.Responses {
+			for _, parameter := range response.Parameters {
+				if strings.HasPrefix(parameter.DataType, "@") {
+					graph.add(from, "parameter", strings.TrimPrefix(parameter.DataType, "@"))
+				}
+			}
+		}
+	}
+
+	for _, entity := range agent.Entities {
+		from := Reference{Kind: "entity", ID: entity.ID, Name: entity.Name}
+
+		for _, entry := range entity.Entries {
+			for _, text := range append([]string{entry.Value}, entry.Synonyms...) {
+				for _, match := range entityReference.FindAllStringSubmatch(text, -1) {
+					graph.add(from, "composite entry", match[1])
+				}
+			}
+		}
+	}
+
+	return graph
+}
+
+// add records that from refers to entity via an element, once per element kind
+func (graph *DependencyGraph) add(from Reference, via, entity string) {
+	from.Via = via
+
+	for _, ref := range graph.users[entity] {
+		if ref == from {
+			return
+		}
+	}
+	graph.users[entity] = append(graph.users[entity], from)
+
+	key := from.Kind + "/" + from.Name
+	if !containsString(graph.needs[key], entity) {
+		graph.needs[key] = append(graph.needs[key], entity)
+	}
+}
+
+// EntityUsers returns the intents and entities that refer to the entity named entity
+func (graph *DependencyGraph) EntityUsers(entity string) []Reference {
+	users := append([]Reference(nil), graph.users[strings.TrimPrefix(entity, "@")]...)
+	sort.SliceStable(users, func(i, j int) bool {
+		if users[i].Kind != users[j].Kind {
+			return users[i].Kind > users[j].Kind
+		}
+		return users[i].Name < users[j].Name
+	})
+
+	return users
+}
+
+// IntentEntities returns the names of the entities the intent named intent needs
+func (graph *DependencyGraph) IntentEntities(intent string) []string {
+	return graph.sorted("intent/" + intent)
+}
+
+// EntityEntities returns the names of the entities the composite entity named entity is built from
+func (graph *DependencyGraph) EntityEntities(entity string) []string {
+	return graph.sorted("entity/" + entity)
+}
+
+func (graph *DependencyGraph) sorted(key string) []string {
+	names := append([]string(nil), graph.needs[key]...)
+	sort.Strings(names)
+	return names
+}
+
+// InUseError is returned when deleting an entity that is still referenced
+type InUseError struct {
+	Entity     string
+	References []Reference
+}
+
+func (err *InUseError) Error() string {
+	refs := make([]string, len(err.References))
+	for i, ref := range err.References {
+		refs[i] = ref.String()
+	}
+
+	return fmt.Sprintf("entity %q is still used by %s", err.Entity, strings.Join(refs, ", "))
+}
+
+// SafeDeleteEntity deletes the entity with ID id, unless intents or other entities still
+// refer to it, in which case it returns an *InUseError
+// Setting force deletes the entity regardless
+func (client *Client) SafeDeleteEntity(id string, force bool) (model.QueryResponse, error) {
+	var response model.QueryResponse
+
+	if id == "" {
+		return response, errors.New("id cannot be empty")
+	}
+
+	if !force {
+		entity, err := client.GetEntity(id)
+		if err != nil {
+			return response, err
+		}
+		if entity.ID == "" {
+			return response, fmt.Errorf("entity %q: %w", id, ErrNotFound)
+		}
+
+		agent, err := client.LoadAgent(defaultConcurrency)
+		if err != nil {
+			return response, err
+		}
+
+		var refs []Reference
+		for _, ref := range BuildDependencyGraph(agent).EntityUsers(entity.Name) {
+			if ref.Kind != "entity" || ref.Name != entity.Name {
+				refs = append(refs, ref)
+			}
+		}
+
+		if len(refs) > 0 {
+			return response, &InUseError{Entity: entity.Name, References: refs}
+		}
+	}
+
+	return client.DeleteEntity(id)
+}
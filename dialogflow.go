@@ -1,5 +1,7 @@
 package dialogflow
 
+import "time"
+
 // NewClient creates a new DialogFlow client
 // You must provide a valid agent access token
 func NewClient(token string) *Client {
@@ -20,3 +22,48 @@ func NewClient(token string) *Client {
 func (c *Client) SetProtocol(s string) {
 	c.protocol = s
 }
+
+// SetDryRun toggles dry-run mode
+// While enabled, mutating calls are recorded into the client's plan
+// instead of being sent, and report a successful status
+func (c *Client) SetDryRun(enabled bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dryRun = enabled
+}
+
+// SetSnapshotStore sets the store that receives a snapshot of every intent
+// and entity right before it is updated or deleted
+// Pass nil to disable snapshots
+func (c *Client) SetSnapshotStore(store SnapshotStore) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.snapshots = store
+}
+
+// SetAuditSink sets the sink that records every create, update and delete
+// sent through the client
+// Pass nil to disable auditing
+func (c *Client) SetAuditSink(sink AuditSink) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auditSink = sink
+}
+
+// SetActor sets who is responsible for the mutations recorded in the audit log
+func (c *Client) SetActor(actor string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.actor = actor
+}
+
+// SetRateLimit limits the client to perSecond requests per second,
+// shared by all goroutines using it
+// A value of 0 removes the limit
+func (c *Client) SetRateLimit(perSecond float64) {
+	var interval time.Duration
+	if perSecond > 0 {
+		interval = time.Duration(float64(time.Second) / perSecond)
+	}
+	c.limiter.setInterval(interval)
+}
@@ -73,9 +73,10 @@ func (client *Client) CreateEntity(entity model.Entity) (model.QueryResponse, er
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   entityPath,
-			Method: http.MethodPost,
-			Body:   entity,
+			Operation: "CreateEntity",
+			Path:      entityPath,
+			Method:    http.MethodPost,
+			Body:      entity,
 		},
 	)
 
@@ -90,28 +91,11 @@ func (client *Client) CreateEntity(entity model.Entity) (model.QueryResponse, er
 
 // AddEntityEntries adds entries to the entity with ID id
 func (client *Client) AddEntityEntries(id string, entries []model.Entry) (model.QueryResponse, error) {
-	var response model.QueryResponse
-
 	if reflect.DeepEqual(entries, []model.Entry{}) || id == "" {
-		return response, errors.New("entries and id cannot be empty")
-	}
-
-	request := newRequest(
-		client,
-		requestOptions{
-			Path:   fmt.Sprintf("%s/%s/%s", entityPath, id, entryPath),
-			Method: http.MethodPost,
-			Body:   entries,
-		},
-	)
-
-	data, err := request.perform()
-	if err != nil {
-		return response, err
+		return model.QueryResponse{}, errors.New("entries and id cannot be empty")
 	}
 
-	err = json.Unmarshal(data, &response)
-	return response, err
+	return client.sendEntityEntries("AddEntityEntries", http.MethodPost, id, entries, false)
 }
 
 // UpdateEntities creates or updates an array of entities
@@ -125,9 +109,10 @@ func (client *Client) UpdateEntities(entities []model.Entity) (model.QueryRespon
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   entityPath,
-			Method: http.MethodPut,
-			Body:   entities,
+			Operation: "UpdateEntities",
+			Path:      entityPath,
+			Method:    http.MethodPut,
+			Body:      entities,
 		},
 	)
 
@@ -151,9 +136,10 @@ func (client *Client) UpdateEntity(id string, entity model.Entity) (model.QueryR
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   fmt.Sprintf("%s/%s", entityPath, id),
-			Method: http.MethodPut,
-			Body:   entity,
+			Operation: "UpdateEntity",
+			Path:      fmt.Sprintf("%s/%s", entityPath, id),
+			Method:    http.MethodPut,
+			Body:      entity,
 		},
 	)
 
@@ -168,18 +154,26 @@ func (client *Client) UpdateEntity(id string, entity model.Entity) (model.QueryR
 
 // UpdateEntityEntries updates entries of entity with ID id
 func (client *Client) UpdateEntityEntries(id string, entries []model.Entry) (model.QueryResponse, error) {
-	var response model.QueryResponse
-
 	if reflect.DeepEqual(entries, model.Entry{}) || id == "" {
-		return response, errors.New("entries and id cannot be empty")
+		return model.QueryResponse{}, errors.New("entries and id cannot be empty")
 	}
 
+	return client.sendEntityEntries("UpdateEntityEntries", http.MethodPut, id, entries, false)
+}
+
+// sendEntityEntries adds or updates entries of the entity with ID id
+// noSnapshot skips the snapshot of the entity, for callers that took one already
+func (client *Client) sendEntityEntries(operation, method, id string, entries []model.Entry, noSnapshot bool) (model.QueryResponse, error) {
+	var response model.QueryResponse
+
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   fmt.Sprintf("%s/%s/%s", entityPath, id, entryPath),
-			Method: http.MethodPut,
-			Body:   entries,
+			Operation:  operation,
+			Path:       fmt.Sprintf("%s/%s/%s", entityPath, id, entryPath),
+			Method:     method,
+			Body:       entries,
+			NoSnapshot: noSnapshot,
 		},
 	)
 
@@ -203,8 +197,9 @@ func (client *Client) DeleteEntity(id string) (model.QueryResponse, error) {
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   fmt.Sprintf("%s/%s", entityPath, id),
-			Method: http.MethodDelete,
+			Operation: "DeleteEntity",
+			Path:      fmt.Sprintf("%s/%s", entityPath, id),
+			Method:    http.MethodDelete,
 		},
 	)
 
@@ -228,9 +223,10 @@ func (client *Client) DeleteEntityEntries(id string, values []string) (model.Que
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   fmt.Sprintf("%s/%s/%s", entityPath, id, entryPath),
-			Method: http.MethodDelete,
-			Body:   values,
+			Operation: "DeleteEntityEntries",
+			Path:      fmt.Sprintf("%s/%s/%s", entityPath, id, entryPath),
+			Method:    http.MethodDelete,
+			Body:      values,
 		},
 	)
 
@@ -254,6 +250,7 @@ func (client *Client) CreateUserEntities(session string, userEntities []model.Us
 	request := newRequest(
 		client,
 		requestOptions{
+			Operation: "CreateUserEntities",
 			Path:      userEntityPath,
 			SessionID: session,
 			Method:    http.MethodPost,
@@ -287,6 +284,7 @@ func (client *Client) UpdateUserEntity(session, name string, userEntity model.Us
 	request := newRequest(
 		client,
 		requestOptions{
+			Operation: "UpdateUserEntity",
 			Path:      fmt.Sprintf("%s/%s", userEntityPath, name),
 			SessionID: session,
 			Method:    http.MethodPut,
@@ -340,6 +338,7 @@ func (client *Client) DeleteUserEntity(session, name string) (model.QueryRespons
 	request := newRequest(
 		client,
 		requestOptions{
+			Operation: "DeleteUserEntity",
 			Path:      fmt.Sprintf("%s/%s", userEntityPath, name),
 			SessionID: session,
 			Method:    http.MethodDelete,
@@ -0,0 +1,291 @@
+package dialogflow
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+	"sort"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// errStopScan ends a scan early when the consumer of an iterator stops
+var errStopScan = errors.New("scan stopped")
+
+// ErrEmptySource is reported when a sync source yields no entries and AllowEmpty is not set
+var ErrEmptySource = errors.New("source yielded no entries")
+
+// EntryDelta is the set of changes that turns the entries of an entity into the desired ones
+type EntryDelta struct {
+	Added   []model.Entry
+	Changed []model.Entry
+	Removed []string
+}
+
+// Empty reports whether the delta changes nothing
+func (delta EntryDelta) Empty() bool {
+	return len(delta.Added) == 0 && len(delta.Changed) == 0 && len(delta.Removed) == 0
+}
+
+// DiffEntries computes the changes that turn current into desired
+// Entries are matched by value, and an entry is changed if its set of synonyms differs
+func DiffEntries(current, desired []model.Entry) EntryDelta {
+	var delta EntryDelta
+
+	existing := make(map[string]model.Entry, len(current))
+	for _, entry := range current {
+		existing[entry.Value] = entry
+	}
+
+	wanted := make(map[string]bool, len(desired))
+	for _, entry := range desired {
+		wanted[entry.Value] = true
+
+		previous, ok := existing[entry.Value]
+		switch {
+		case !ok:
+			delta.Added = append(delta.Added, entry)
+		case !sameSynonyms(previous.Synonyms, entry.Synonyms):
+			delta.Changed = append(delta.Changed, entry)
+		}
+	}
+
+	for _, entry := range current {
+		if !wanted[entry.Value] {
+			delta.Removed = append(delta.Removed, entry.Value)
+		}
+	}
+
+	return delta
+}
+
+func sameSynonyms(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	x := append([]string(nil), a...)
+	y := append([]string(nil), b...)
+	sort.Strings(x)
+	sort.Strings(y)
+
+	for i := range x {
+		if x[i] != y[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// SyncReport summarizes a synchronisation run
+type SyncReport struct {
+	Started  time.Time
+	Finished time.Time
+	Added    int
+	Changed  int
+	Removed  int
+}
+
+// EntitySync keeps the entries of an entity in line with an external source
+type EntitySync struct {
+	Client   *Client
+	EntityID string
+
+	// Source yields the desired entries, and is iterated once per run
+	Source iter.Seq2[model.Entry, error]
+
+	// KeepMissing leaves entries that are absent from the source in place
+	KeepMissing bool
+
+	// AllowEmpty accepts a source that yields no entries, which removes every entry
+	// unless KeepMissing is set
+	// Without it an empty source fails the run, since it is more often a broken
+	// query or file than an intentionally empty entity
+	AllowEmpty bool
+
+	// Uploader configures how added and changed entries are sent
+	// Its Client, EntityID, Update and Offset fields are set by the sync
+	Uploader EntryUploader
+}
+
+// Diff computes the changes a run would apply, without applying them
+func (entitySync *EntitySync) Diff() (EntryDelta, error) {
+	if entitySync.Client == nil || entitySync.EntityID == "" || entitySync.Source == nil {
+		return EntryDelta{}, errors.New("client, entity id and source cannot be empty")
+	}
+
+	var desired []model.Entry
+	collect := UniqueEntries(func(entry model.Entry) error {
+		desired = append(desired, entry)
+		return nil
+	})
+
+	for entry, err := range entitySync.Source {
+		if err == nil {
+			err = collect(entry)
+		}
+		if err != nil {
+			return EntryDelta{}, fmt.Errorf("reading source: %w", err)
+		}
+	}
+
+	if len(desired) == 0 && !entitySync.AllowEmpty {
+		return EntryDelta{}, ErrEmptySource
+	}
+
+	entity, err := entitySync.Client.GetEntity(entitySync.EntityID)
+	if err != nil {
+		return EntryDelta{}, err
+	}
+	if entity.ID == "" {
+		return EntryDelta{}, fmt.Errorf("entity %q: %w", entitySync.EntityID, ErrNotFound)
+	}
+
+	delta := DiffEntries(entity.Entries, desired)
+	if entitySync.KeepMissing {
+		delta.Removed = nil
+	}
+
+	return delta, nil
+}
+
+// Run computes the delta between the source and the entity and applies it
+func (entitySync *EntitySync) Run() (SyncReport, error) {
+	report := SyncReport{Started: time.Now()}
+
+	delta, err := entitySync.Diff()
+	if err != nil {
+		return report, err
+	}
+
+	uploader := entitySync.Uploader
+	uploader.Client, uploader.EntityID, uploader.Offset = entitySync.Client, entitySync.EntityID, 0
+
+	if len(delta.Added) > 0 {
+		uploader.Update = false
+		if err := uploader.Upload(delta.Added); err != nil {
+			return report, fmt.Errorf("adding entries: %w", err)
+		}
+		report.Added = len(delta.Added)
+	}
+
+	if len(delta.Changed) > 0 {
+		uploader.Update = true
+		if err := uploader.Upload(delta.Changed); err != nil {
+			return report, fmt.Errorf("updating entries: %w", err)
+		}
+		report.Changed = len(delta.Changed)
+	}
+
+	if len(delta.Removed) > 0 {
+		response, err := entitySync.Client.DeleteEntityEntries(entitySync.EntityID, delta.Removed)
+		if err == nil {
+			err = statusError(response.Status)
+		}
+		if err != nil {
+			return report, fmt.Errorf("removing entries: %w", err)
+		}
+		report.Removed = len(delta.Removed)
+	}
+
+	report.Finished = time.Now()
+	return report, nil
+}
+
+// Schedule runs the sync immediately and then every interval until ctx is done,
+// passing the outcome of each run to report
+func (entitySync *EntitySync) Schedule(ctx context.Context, interval time.Duration, report func(SyncReport, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := entitySync.Run()
+		if report != nil {
+			report(result, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// SQLEntries returns a source running query against db on every iteration
+// The first column of each row is the entry value and the remaining columns its synonyms
+// NULL and empty synonyms are skipped, and a row without synonyms gets its value as synonym
+func SQLEntries(db *sql.DB, query string, args ...interface{}) iter.Seq2[model.Entry, error] {
+	return func(yield func(model.Entry, error) bool) {
+		rows, err := db.Query(query, args...)
+		if err != nil {
+			yield(model.Entry{}, err)
+			return
+		}
+		defer rows.Close()
+
+		columns, err := rows.Columns()
+		if err != nil {
+			yield(model.Entry{}, err)
+			return
+		}
+
+		for rows.Next() {
+			fields := make([]sql.NullString, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range fields {
+				dest[i] = &fields[i]
+			}
+
+			if err := rows.Scan(dest...); err != nil {
+				yield(model.Entry{}, err)
+				return
+			}
+
+			entry := model.Entry{Value: fields[0].String}
+			for _, field := range fields[1:] {
+				if field.Valid && field.String != "" {
+					entry.Synonyms = append(entry.Synonyms, field.String)
+				}
+			}
+			if len(entry.Synonyms) == 0 {
+				entry.Synonyms = []string{entry.Value}
+			}
+
+			if !yield(entry, nil) {
+				return
+			}
+		}
+
+		if err := rows.Err(); err != nil {
+			yield(model.Entry{}, err)
+		}
+	}
+}
+
+// CSVEntries returns a source reading the CSV file returned by open on every iteration,
+// in the layout accepted by ScanEntriesCSV
+func CSVEntries(open func() (io.ReadCloser, error)) iter.Seq2[model.Entry, error] {
+	return func(yield func(model.Entry, error) bool) {
+		file, err := open()
+		if err != nil {
+			yield(model.Entry{}, err)
+			return
+		}
+		defer file.Close()
+
+		err = ScanEntriesCSV(file, func(entry model.Entry) error {
+			if !yield(entry, nil) {
+				return errStopScan
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, errStopScan) {
+			yield(model.Entry{}, err)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+package dialogflow
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// DuplicateError reports an entry value, or a synonym of two different values,
+// that appears more than once
+type DuplicateError struct {
+	// Entry is the position of the offending entry, starting at 1
+	Entry   int
+	Value   string
+	Synonym string
+	// Previous is the value the synonym was first seen with, empty for duplicate values
+	Previous string
+}
+
+func (err *DuplicateError) Error() string {
+	if err.Synonym == "" {
+		return fmt.Sprintf("entry %d: duplicate value %q", err.Entry, err.Value)
+	}
+	return fmt.Sprintf("entry %d: synonym %q of %q already belongs to %q", err.Entry, err.Synonym, err.Value, err.Previous)
+}
+
+// UniqueEntries wraps fn so that it fails with a *DuplicateError when an entry repeats
+// the value of a previous one, or has a synonym that maps to a different value
+// Comparisons are case insensitive, as they are for entity matching
+func UniqueEntries(fn func(model.Entry) error) func(model.Entry) error {
+	values := make(map[string]bool)
+	synonyms := make(map[string]string)
+	n := 0
+
+	return func(entry model.Entry) error {
+		n++
+
+		value := strings.ToLower(entry.Value)
+		if values[value] {
+			return &DuplicateError{Entry: n, Value: entry.Value}
+		}
+		values[value] = true
+
+		for _, synonym := range entry.Synonyms {
+			key := strings.ToLower(synonym)
+			if previous, ok := synonyms[key]; ok && !strings.EqualFold(previous, entry.Value) {
+				return &DuplicateError{Entry: n, Value: entry.Value, Synonym: synonym, Previous: previous}
+			}
+			synonyms[key] = entry.Value
+		}
+
+		return fn(entry)
+	}
+}
+
+// ScanEntriesCSV calls fn for every row of r, in the layout of the DialogFlow console upload:
+// value,synonym1,synonym2,...
+// A row holding only a value gets the value as its single synonym
+func ScanEntriesCSV(r io.Reader, fn func(model.Entry) error) error {
+	reader := csv.NewReader(skipBOM(r))
+	reader.FieldsPerRecord = -1
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		line, _ := reader.FieldPos(0)
+		entry := model.Entry{Value: strings.TrimSpace(record[0])}
+		if entry.Value == "" {
+			return fmt.Errorf("line %d: value cannot be empty", line)
+		}
+
+		for _, synonym := range record[1:] {
+			if synonym = strings.TrimSpace(synonym); synonym != "" {
+				entry.Synonyms = append(entry.Synonyms, synonym)
+			}
+		}
+		if len(entry.Synonyms) == 0 {
+			entry.Synonyms = []string{entry.Value}
+		}
+
+		if err := fn(entry); err != nil {
+			return fmt.Errorf("line %d: %w", line, err)
+		}
+	}
+}
+
+// ReadEntriesCSV reads all entries of r, rejecting duplicates
+func ReadEntriesCSV(r io.Reader) ([]model.Entry, error) {
+	var entries []model.Entry
+
+	err := ScanEntriesCSV(r, UniqueEntries(func(entry model.Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+
+	return entries, err
+}
+
+// WriteEntriesCSV writes entries to w in the layout of the DialogFlow console upload,
+// quoting every field as the console does
+func WriteEntriesCSV(w io.Writer, entries []model.Entry) error {
+	writer := bufio.NewWriter(w)
+
+	for _, entry := range entries {
+		fields := append([]string{entry.Value}, entry.Synonyms...)
+		for i, field := range fields {
+			if i > 0 {
+				writer.WriteByte(',')
+			}
+			writer.WriteString(`"` + strings.Replace(field, `"`, `""`, -1) + `"`)
+		}
+		writer.WriteString("\r\n")
+	}
+
+	return writer.Flush()
+}
+
+// ScanEntriesJSONL calls fn for every entry of r, which holds one JSON entry per line
+func ScanEntriesJSONL(r io.Reader, fn func(model.Entry) error) error {
+	return decodeEntries(r, fn)
+}
+
+// ReadEntriesJSONL reads all entries of r, rejecting duplicates
+func ReadEntriesJSONL(r io.Reader) ([]model.Entry, error) {
+	var entries []model.Entry
+
+	err := ScanEntriesJSONL(r, UniqueEntries(func(entry model.Entry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+
+	return entries, err
+}
+
+// WriteEntriesJSONL writes entries to w, one JSON entry per line
+func WriteEntriesJSONL(w io.Writer, entries []model.Entry) error {
+	encoder := json.NewEncoder(w)
+
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// SyncEntityCSV replaces the entries of the entity with ID id with the entries read from r
+func (client *Client) SyncEntityCSV(id string, r io.Reader) (model.QueryResponse, error) {
+	var response model.QueryResponse
+
+	if id == "" {
+		return response, errors.New("id cannot be empty")
+	}
+
+	entries, err := ReadEntriesCSV(r)
+	if err != nil {
+		return response, err
+	}
+	if len(entries) == 0 {
+		return response, errors.New("csv holds no entries")
+	}
+
+	entity, err := client.GetEntity(id)
+	if err != nil {
+		return response, err
+	}
+	if entity.ID == "" {
+		return response, fmt.Errorf("entity %q: %w", id, ErrNotFound)
+	}
+
+	entity.Entries = entries
+	return client.UpdateEntity(id, entity)
+}
+
+// skipBOM returns a reader over r without its leading UTF-8 byte order mark, if any
+func skipBOM(r io.Reader) io.Reader {
+	reader := bufio.NewReader(r)
+
+	if bom, err := reader.Peek(3); err == nil && string(bom) == "\xef\xbb\xbf" {
+		reader.Discard(3)
+	}
+
+	return reader
+}
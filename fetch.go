@@ -0,0 +1,141 @@
+package dialogflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// IntentResult is the outcome of fetching the full details of a single intent
+type IntentResult struct {
+	ID     string
+	Intent model.Intent
+	Err    error
+}
+
+// FetchErrors maps the IDs of intents that could not be fetched to the reason why
+type FetchErrors map[string]error
+
+func (errs FetchErrors) Error() string {
+	ids := make([]string, 0, len(errs))
+	for id := range errs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	messages := make([]string, len(ids))
+	for i, id := range ids {
+		messages[i] = fmt.Sprintf("%s: %v", id, errs[id])
+	}
+
+	return fmt.Sprintf("could not fetch %d intents: %s", len(errs), strings.Join(messages, "; "))
+}
+
+// FetchIntents fetches the full details of the intents with the given IDs,
+// with at most concurrency requests in flight and subject to the client's rate limit
+// If ids is empty, every intent of the agent is fetched
+// Results are streamed in completion order and the channel is closed once all
+// intents are fetched or ctx is done
+func (client *Client) FetchIntents(ctx context.Context, ids []string, concurrency int) <-chan IntentResult {
+	results := make(chan IntentResult)
+
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	go func() {
+		defer close(results)
+
+		if len(ids) == 0 {
+			intents, err := client.GetAllIntents()
+			if err != nil {
+				select {
+				case results <- IntentResult{Err: err}:
+				case <-ctx.Done():
+				}
+				return
+			}
+
+			for _, intent := range intents {
+				ids = append(ids, intent.ID)
+			}
+		}
+
+		pending := make(chan string)
+		var wg sync.WaitGroup
+
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for id := range pending {
+					intent, status, err := client.getIntent(id)
+					if err == nil {
+						err = statusError(status)
+					}
+					select {
+					case results <- IntentResult{ID: id, Intent: intent, Err: err}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}()
+		}
+
+	feed:
+		for _, id := range ids {
+			select {
+			case pending <- id:
+			case <-ctx.Done():
+				break feed
+			}
+		}
+		close(pending)
+		wg.Wait()
+	}()
+
+	return results
+}
+
+// GetIntents fetches the full details of the intents with the given IDs concurrently
+// and returns them in the order of ids
+// If ids is empty, every intent of the agent is fetched
+// Intents that could not be fetched are left out and reported in a FetchErrors
+func (client *Client) GetIntents(ids []string, concurrency int) ([]model.Intent, error) {
+	if len(ids) == 0 {
+		all, err := client.GetAllIntents()
+		if err != nil {
+			return nil, err
+		}
+		for _, intent := range all {
+			ids = append(ids, intent.ID)
+		}
+	}
+
+	fetched := make(map[string]model.Intent)
+	failed := make(FetchErrors)
+
+	for result := range client.FetchIntents(context.Background(), ids, concurrency) {
+		if result.Err != nil {
+			failed[result.ID] = result.Err
+			continue
+		}
+		fetched[result.ID] = result.Intent
+	}
+
+	var intents []model.Intent
+	for _, id := range ids {
+		if intent, ok := fetched[id]; ok {
+			intents = append(intents, intent)
+		}
+	}
+
+	if len(failed) > 0 {
+		return intents, failed
+	}
+	return intents, nil
+}
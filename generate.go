@@ -0,0 +1,427 @@
+package dialogflow
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// maxCombinations saturates combination counts so they cannot overflow
+const maxCombinations = 1 << 40
+
+// templateNode is a piece of a generator template: literal text, an entity slot,
+// or a group of alternatives that may be optional
+type templateNode struct {
+	text         string
+	entity       string
+	alias        string
+	alternatives [][]templateNode
+	optional     bool
+}
+
+// templateParser parses the generator template language
+type templateParser struct {
+	template string
+	pos      int
+}
+
+func (parser *templateParser) fail(offset int, format string, args ...interface{}) *MarkupError {
+	return &MarkupError{
+		Column:  utf8.RuneCountInString(parser.template[:offset]) + 1,
+		Offset:  offset,
+		Message: fmt.Sprintf(format, args...),
+	}
+}
+
+// sequence parses nodes up to the end of the template, or up to a | or ) when nested
+func (parser *templateParser) sequence(nested bool) ([]templateNode, *MarkupError) {
+	var nodes []templateNode
+	var text strings.Builder
+
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, templateNode{text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for parser.pos < len(parser.template) {
+		r, size := utf8.DecodeRuneInString(parser.template[parser.pos:])
+
+		switch {
+		case r == '\\':
+			if parser.pos+size >= len(parser.template) {
+				return nil, parser.fail(parser.pos, "backslash at end of template")
+			}
+			escaped, escapedSize := utf8.DecodeRuneInString(parser.template[parser.pos+size:])
+			text.WriteRune(escaped)
+			parser.pos += size + escapedSize
+
+		case r == '|' || r == ')':
+			if !nested {
+				return nil, parser.fail(parser.pos, "unexpected %c outside of a group", r)
+			}
+			flush()
+			return nodes, nil
+
+		case r == '(':
+			flush()
+			group, err := parser.group()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, group)
+
+		case r == '@':
+			flush()
+			slot, err := parser.slot()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, slot)
+
+		default:
+			text.WriteRune(r)
+			parser.pos += size
+		}
+	}
+
+	flush()
+	return nodes, nil
+}
+
+// group parses (a|b|c), optionally followed by ? to make it optional
+func (parser *templateParser) group() (templateNode, *MarkupError) {
+	start := parser.pos
+	parser.pos++
+
+	var node templateNode
+	for {
+		alternative, err := parser.sequence(true)
+		if err != nil {
+			return node, err
+		}
+		if parser.pos >= len(parser.template) {
+			return node, parser.fail(start, "unclosed (")
+		}
+		node.alternatives = append(node.alternatives, alternative)
+
+		closing := parser.template[parser.pos] == ')'
+		parser.pos++
+		if closing {
+			break
+		}
+	}
+
+	if parser.pos < len(parser.template) && parser.template[parser.pos] == '?' {
+		node.optional = true
+		parser.pos++
+	}
+
+	return node, nil
+}
+
+// slot parses @entity or @entity:alias
+func (parser *templateParser) slot() (templateNode, *MarkupError) {
+	start := parser.pos
+	parser.pos++
+
+	name := parser.name(true)
+	if name == "" {
+		return templateNode{}, parser.fail(start, "expected entity name after @")
+	}
+
+	node := templateNode{entity: name, alias: name}
+	if strings.HasPrefix(name, "sys.") {
+		node.alias = strings.TrimPrefix(name, "sys.")
+	}
+
+	if parser.pos < len(parser.template) && parser.template[parser.pos] == ':' {
+		parser.pos++
+		if node.alias = parser.name(false); node.alias == "" {
+			return templateNode{}, parser.fail(parser.pos, "expected alias after :")
+		}
+	}
+
+	return node, nil
+}
+
+// name consumes an entity name or alias
+// A dot is part of an entity name only if a name character follows it
+func (parser *templateParser) name(dots bool) string {
+	start := parser.pos
+	for parser.pos < len(parser.template) {
+		c := parser.template[parser.pos]
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '_', c == '-':
+		case c == '.' && dots && parser.pos+1 < len(parser.template) && isNameByte(parser.template[parser.pos+1]):
+		default:
+			return parser.template[start:parser.pos]
+		}
+		parser.pos++
+	}
+	return parser.template[start:parser.pos]
+}
+
+func isNameByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-'
+}
+
+// Generator expands templates into annotated training phrases
+//
+// Templates are plain text with (a|b) alternatives, (optional parts)? and @entity or
+// @entity:alias slots, e.g.
+//
+//	(book|reserve) a (table|spot) for @sys.number:guests people( tonight)?
+//
+// A backslash escapes the next character
+type Generator struct {
+	// Values are the values to fill slots with, by entity name without the @
+	Values map[string][]string
+	// Seed makes sampling deterministic
+	Seed int64
+	// Max caps the number of phrases returned by a call to Generate, 100 if zero
+	// It is shared evenly between templates
+	Max int
+}
+
+// EntityValues collects the synonyms of entities as slot values
+func EntityValues(entities []model.Entity) map[string][]string {
+	values := make(map[string][]string)
+	for _, entity := range entities {
+		for _, entry := range entity.Entries {
+			synonyms := entry.Synonyms
+			if len(synonyms) == 0 {
+				synonyms = []string{entry.Value}
+			}
+			for _, synonym := range synonyms {
+				if !strings.Contains(synonym, "@") && !containsString(values[entity.Name], synonym) {
+					values[entity.Name] = append(values[entity.Name], synonym)
+				}
+			}
+		}
+	}
+	return values
+}
+
+// Generate expands templates into at most Max distinct training phrases
+// Templates with few combinations are expanded fully, the others are sampled
+func (generator *Generator) Generate(templates ...string) ([]model.UserSay, error) {
+	if len(templates) == 0 {
+		return nil, errors.New("templates cannot be empty")
+	}
+
+	max := generator.Max
+	if max <= 0 {
+		max = 100
+	}
+
+	parsed := make([][]templateNode, len(templates))
+	for i, template := range templates {
+		parser := &templateParser{template: template}
+		nodes, err := parser.sequence(false)
+		if err != nil {
+			err.Line = i + 1
+			return nil, err
+		}
+		if err := generator.check(nodes); err != nil {
+			return nil, fmt.Errorf("template %d: %v", i+1, err)
+		}
+		parsed[i] = nodes
+	}
+
+	random := rand.New(rand.NewSource(generator.Seed))
+	seen := make(map[string]bool)
+	var userSays []model.UserSay
+
+	for i, nodes := range parsed {
+		quota := max / len(parsed)
+		if i < max%len(parsed) {
+			quota++
+		}
+
+		added := 0
+		add := func(data []model.Data) {
+			userSay := model.UserSay{Data: normalizeData(data)}
+			key := strings.ToLower(FormatUserSay(userSay))
+			if len(userSay.Data) == 0 || seen[key] {
+				return
+			}
+
+			seen[key] = true
+			userSays = append(userSays, userSay)
+			added++
+		}
+
+		if generator.combinations(nodes) <= quota {
+			for _, data := range generator.expand(nodes) {
+				add(data)
+			}
+			continue
+		}
+
+		// Sampling gives up after a while, in case most samples are duplicates
+		for attempt := 0; attempt < quota*10 && added < quota; attempt++ {
+			add(generator.sample(nodes, random))
+		}
+	}
+
+	return userSays, nil
+}
+
+// check verifies that every slot has values
+func (generator *Generator) check(nodes []templateNode) error {
+	for _, node := range nodes {
+		if node.entity != "" && len(generator.Values[node.entity]) == 0 {
+			return fmt.Errorf("no values for @%s", node.entity)
+		}
+		for _, alternative := range node.alternatives {
+			if err := generator.check(alternative); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// combinations counts the phrases nodes expand to, saturating at maxCombinations
+func (generator *Generator) combinations(nodes []templateNode) int {
+	total := 1
+	for _, node := range nodes {
+		count := 1
+		switch {
+		case node.entity != "":
+			count = len(generator.Values[node.entity])
+		case node.alternatives != nil:
+			count = 0
+			for _, alternative := range node.alternatives {
+				count += generator.combinations(alternative)
+				if count > maxCombinations {
+					count = maxCombinations
+				}
+			}
+			if node.optional && count < maxCombinations {
+				count++
+			}
+		}
+
+		if count != 0 && total > maxCombinations/count {
+			return maxCombinations
+		}
+		total *= count
+	}
+	return total
+}
+
+// expand returns every phrase nodes expand to
+func (generator *Generator) expand(nodes []templateNode) [][]model.Data {
+	results := [][]model.Data{nil}
+
+	for _, node := range nodes {
+		var options [][]model.Data
+		switch {
+		case node.entity != "":
+			for _, value := range generator.Values[node.entity] {
+				options = append(options, []model.Data{slotData(node, value)})
+			}
+		case node.alternatives != nil:
+			if node.optional {
+				options = append(options, nil)
+			}
+			for _, alternative := range node.alternatives {
+				options = append(options, generator.expand(alternative)...)
+			}
+		default:
+			options = [][]model.Data{{{Text: node.text}}}
+		}
+
+		var next [][]model.Data
+		for _, prefix := range results {
+			for _, option := range options {
+				next = append(next, append(append([]model.Data(nil), prefix...), option...))
+			}
+		}
+		results = next
+	}
+
+	return results
+}
+
+// sample returns a random phrase of nodes
+func (generator *Generator) sample(nodes []templateNode, random *rand.Rand) []model.Data {
+	var data []model.Data
+
+	for _, node := range nodes {
+		switch {
+		case node.entity != "":
+			values := generator.Values[node.entity]
+			data = append(data, slotData(node, values[random.Intn(len(values))]))
+		case node.alternatives != nil:
+			if node.optional && random.Intn(2) == 0 {
+				continue
+			}
+			alternative := node.alternatives[random.Intn(len(node.alternatives))]
+			data = append(data, generator.sample(alternative, random)...)
+		default:
+			data = append(data, model.Data{Text: node.text})
+		}
+	}
+
+	return data
+}
+
+func slotData(node templateNode, value string) model.Data {
+	return model.Data{Text: value, Meta: "@" + node.entity, Alias: node.alias, UserDefined: true}
+}
+
+// normalizeData merges adjacent plain segments and collapses the white space left by
+// omitted optional parts
+func normalizeData(data []model.Data) []model.Data {
+	var merged []model.Data
+	for _, segment := range data {
+		if n := len(merged); n > 0 && segment.Meta == "" && merged[n-1].Meta == "" {
+			merged[n-1].Text += segment.Text
+			continue
+		}
+		merged = append(merged, segment)
+	}
+
+	var normalized []model.Data
+	space := true
+	for _, segment := range merged {
+		if segment.Meta != "" {
+			normalized = append(normalized, segment)
+			space = false
+			continue
+		}
+
+		var b strings.Builder
+		for _, r := range segment.Text {
+			isSpace := r == ' ' || r == '\t'
+			if isSpace && space {
+				continue
+			}
+			if isSpace {
+				r = ' '
+			}
+			b.WriteRune(r)
+			space = isSpace
+		}
+		if b.Len() > 0 {
+			normalized = append(normalized, model.Data{Text: b.String()})
+		}
+	}
+
+	if n := len(normalized); n > 0 && normalized[n-1].Meta == "" {
+		normalized[n-1].Text = strings.TrimRight(normalized[n-1].Text, " ")
+		if normalized[n-1].Text == "" {
+			normalized = normalized[:n-1]
+		}
+	}
+
+	return normalized
+}
@@ -0,0 +1,215 @@
+package dialogflow
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestGenerateExpandsSmallTemplates(t *testing.T) {
+	generator := &Generator{
+		Values: map[string][]string{
+			"city":       {"paris", "rome"},
+			"sys.number": {"two"},
+		},
+	}
+
+	userSays, err := generator.Generate("(book|reserve) a table in @city for @sys.number:guests( tonight)?")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 2 verbs, 2 cities, 1 number and an optional part
+	if len(userSays) != 8 {
+		t.Fatalf("got %d phrases, want 8", len(userSays))
+	}
+
+	want := "book a table in [paris](@city:city) for [two](@sys.number:guests)"
+	found := false
+	for _, userSay := range userSays {
+		if FormatUserSay(userSay) == want {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("phrases do not include %q", want)
+	}
+}
+
+func TestGenerateSlots(t *testing.T) {
+	tests := []struct {
+		template string
+		meta     string
+		alias    string
+	}{
+		{"to @city", "@city", "city"},
+		{"to @city:destination", "@city", "destination"},
+		{"at @sys.time", "@sys.time", "time"},
+		{"at @sys.time.", "@sys.time", "time"},
+	}
+
+	generator := &Generator{
+		Values: map[string][]string{"city": {"paris"}, "sys.time": {"noon"}},
+	}
+
+	for _, test := range tests {
+		userSays, err := generator.Generate(test.template)
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		if len(userSays) != 1 || len(userSays[0].Data) < 2 {
+			t.Errorf("%q: got %+v", test.template, userSays)
+			continue
+		}
+
+		slot := userSays[0].Data[1]
+		if slot.Meta != test.meta || slot.Alias != test.alias || !slot.UserDefined {
+			t.Errorf("%q: got slot %+v, want meta %s and alias %s", test.template, slot, test.meta, test.alias)
+		}
+	}
+}
+
+func TestGenerateNormalizesSpaces(t *testing.T) {
+	generator := &Generator{}
+
+	userSays, err := generator.Generate("(please )?open( the)? door")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, userSay := range userSays {
+		text := FormatUserSay(userSay)
+		if strings.Contains(text, "  ") || strings.TrimSpace(text) != text {
+			t.Errorf("phrase %q has stray spaces", text)
+		}
+	}
+	if len(userSays) != 4 {
+		t.Errorf("got %d phrases, want 4", len(userSays))
+	}
+}
+
+func TestGenerateDeduplicates(t *testing.T) {
+	generator := &Generator{}
+
+	userSays, err := generator.Generate("(hi|Hi|hello)", "hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(userSays) != 2 {
+		t.Errorf("got %d phrases, want 2", len(userSays))
+	}
+}
+
+func TestGenerateCapsPhrases(t *testing.T) {
+	values := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	generator := &Generator{
+		Values: map[string][]string{"x": values, "y": values, "z": values},
+		Max:    25,
+		Seed:   1,
+	}
+
+	userSays, err := generator.Generate("@x @y @z", "@x or @y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userSays) != 25 {
+		t.Errorf("got %d phrases, want 25", len(userSays))
+	}
+
+	again, err := generator.Generate("@x @y @z", "@x or @y")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range userSays {
+		if FormatUserSay(userSays[i]) != FormatUserSay(again[i]) {
+			t.Fatalf("sampling with the same seed differs at phrase %d", i+1)
+		}
+	}
+}
+
+func TestGenerateDefaultMax(t *testing.T) {
+	values := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	generator := &Generator{Values: map[string][]string{"x": values}}
+
+	userSays, err := generator.Generate("@x @x @x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userSays) != 100 {
+		t.Errorf("got %d phrases, want 100", len(userSays))
+	}
+}
+
+func TestCombinations(t *testing.T) {
+	values := make([]string, 1000)
+	generator := &Generator{Values: map[string][]string{"x": values}}
+
+	tests := []struct {
+		template string
+		want     int
+	}{
+		{"hello", 1},
+		{"(a|b|c)", 3},
+		{"(a|b)?", 3},
+		{"(a|b) (c|d)", 4},
+		{"@x", 1000},
+		{"@x (@x|@x)", 2000000},
+		// 1000^5 exceeds maxCombinations
+		{"@x @x @x @x @x", maxCombinations},
+		// 1000^7 overflows an int unless saturated before multiplying
+		{"@x @x @x @x @x @x @x", maxCombinations},
+		{"@x @x @x @x (@x @x @x @x @x|b)", maxCombinations},
+		{"(@x @x @x @x @x|@x @x @x @x @x)?", maxCombinations},
+		{"(@x @x @x @x @x|@x @x @x @x @x) (@x @x @x @x @x|b)", maxCombinations},
+	}
+
+	for _, test := range tests {
+		parser := &templateParser{template: test.template}
+		nodes, err := parser.sequence(false)
+		if err != nil {
+			t.Errorf("%q: %v", test.template, err)
+			continue
+		}
+		if got := generator.combinations(nodes); got != test.want {
+			t.Errorf("%q: got %d combinations, want %d", test.template, got, test.want)
+		}
+	}
+}
+
+func TestGenerateErrors(t *testing.T) {
+	tests := []struct {
+		template string
+		column   int
+	}{
+		{"(a|b", 1},
+		{"a|b", 2},
+		{"a )", 3},
+		{"café @", 6},
+		{"@city:", 7},
+		{`trailing \`, 10},
+	}
+
+	generator := &Generator{Values: map[string][]string{"city": {"paris"}}}
+
+	for _, test := range tests {
+		_, err := generator.Generate("ok", test.template)
+
+		var markupErr *MarkupError
+		if !errors.As(err, &markupErr) {
+			t.Errorf("%q: got %v, want a MarkupError", test.template, err)
+			continue
+		}
+		if markupErr.Line != 2 || markupErr.Column != test.column {
+			t.Errorf("%q: got line %d column %d, want line 2 column %d", test.template, markupErr.Line, markupErr.Column, test.column)
+		}
+	}
+
+	if _, err := generator.Generate("to @town"); err == nil {
+		t.Error("slot without values: got no error")
+	}
+	if _, err := generator.Generate(); err == nil {
+		t.Error("no templates: got no error")
+	}
+}
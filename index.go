@@ -0,0 +1,150 @@
+package dialogflow
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// ErrNotFound is returned when a resource looked up by name does not exist
+var ErrNotFound = errors.New("not found")
+
+// nameIndex caches the name to ID mapping of the agent's intents and entities
+// Each map is loaded on first use and dropped whenever its resource is mutated
+type nameIndex struct {
+	mu       sync.Mutex
+	intents  map[string]string
+	entities map[string]string
+}
+
+// invalidate drops the cached mapping for the resource at path
+func (index *nameIndex) invalidate(path string) {
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	switch strings.SplitN(path, "/", 2)[0] {
+	case intentPath:
+		index.intents = nil
+	case entityPath:
+		index.entities = nil
+	}
+}
+
+// intentID returns the ID of the intent named name
+func (client *Client) intentID(name string) (string, error) {
+	index := &client.index
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if index.intents == nil {
+		intents, err := client.GetAllIntents()
+		if err != nil {
+			return "", err
+		}
+
+		index.intents = make(map[string]string, len(intents))
+		for _, intent := range intents {
+			index.intents[intent.Name] = intent.ID
+		}
+	}
+
+	id, ok := index.intents[name]
+	if !ok {
+		return "", fmt.Errorf("intent %q: %w", name, ErrNotFound)
+	}
+	return id, nil
+}
+
+// entityID returns the ID of the entity named name
+func (client *Client) entityID(name string) (string, error) {
+	index := &client.index
+	index.mu.Lock()
+	defer index.mu.Unlock()
+
+	if index.entities == nil {
+		entities, err := client.GetAllEntities()
+		if err != nil {
+			return "", err
+		}
+
+		index.entities = make(map[string]string, len(entities))
+		for _, entity := range entities {
+			index.entities[entity.Name] = entity.ID
+		}
+	}
+
+	id, ok := index.entities[name]
+	if !ok {
+		return "", fmt.Errorf("entity %q: %w", name, ErrNotFound)
+	}
+	return id, nil
+}
+
+// GetIntentByName returns the intent named name
+func (client *Client) GetIntentByName(name string) (model.Intent, error) {
+	if name == "" {
+		return model.Intent{}, errors.New("name cannot be empty")
+	}
+
+	id, err := client.intentID(name)
+	if err != nil {
+		return model.Intent{}, err
+	}
+
+	return client.GetIntent(id)
+}
+
+// GetEntityByName returns the entity named name
+func (client *Client) GetEntityByName(name string) (model.Entity, error) {
+	if name == "" {
+		return model.Entity{}, errors.New("name cannot be empty")
+	}
+
+	id, err := client.entityID(name)
+	if err != nil {
+		return model.Entity{}, err
+	}
+
+	return client.GetEntity(id)
+}
+
+// UpsertIntent updates the intent with the same name as intent, or creates it if there is none
+func (client *Client) UpsertIntent(intent model.Intent) (model.QueryResponse, error) {
+	if intent.Name == "" {
+		return model.QueryResponse{}, errors.New("intent name cannot be empty")
+	}
+
+	id, err := client.intentID(intent.Name)
+	if errors.Is(err, ErrNotFound) {
+		intent.ID = ""
+		return client.CreateIntent(intent)
+	}
+	if err != nil {
+		return model.QueryResponse{}, err
+	}
+
+	intent.ID = id
+	return client.UpdateIntent(id, intent)
+}
+
+// UpsertEntity updates the entity with the same name as entity, or creates it if there is none
+func (client *Client) UpsertEntity(entity model.Entity) (model.QueryResponse, error) {
+	if entity.Name == "" {
+		return model.QueryResponse{}, errors.New("entity name cannot be empty")
+	}
+
+	id, err := client.entityID(entity.Name)
+	if errors.Is(err, ErrNotFound) {
+		entity.ID = ""
+		return client.CreateEntity(entity)
+	}
+	if err != nil {
+		return model.QueryResponse{}, err
+	}
+
+	entity.ID = id
+	return client.UpdateEntity(id, entity)
+}
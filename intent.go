@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"reflect"
 
@@ -36,10 +35,20 @@ func (client *Client) GetAllIntents() ([]model.IntentAgent, error) {
 
 // GetIntent returns the intent with ID id
 func (client *Client) GetIntent(id string) (model.Intent, error) {
-	var response model.Intent
+	intent, _, err := client.getIntent(id)
+	return intent, err
+}
+
+// getIntent returns the intent with ID id along with the status of the response,
+// which is only set when the request failed
+func (client *Client) getIntent(id string) (model.Intent, model.Status, error) {
+	var response struct {
+		model.Intent
+		Status model.Status `json:"status"`
+	}
 
 	if id == "" {
-		return response, errors.New("id cannot be empty")
+		return response.Intent, response.Status, errors.New("id cannot be empty")
 	}
 
 	request := newRequest(
@@ -52,12 +61,11 @@ func (client *Client) GetIntent(id string) (model.Intent, error) {
 
 	data, err := request.perform()
 	if err != nil {
-		return response, err
+		return response.Intent, response.Status, err
 	}
 
-	log.Println(string(data))
 	err = json.Unmarshal(data, &response)
-	return response, err
+	return response.Intent, response.Status, err
 }
 
 // CreateIntent creates a new intent
@@ -71,9 +79,10 @@ func (client *Client) CreateIntent(intent model.Intent) (model.QueryResponse, er
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   intentPath,
-			Method: http.MethodPost,
-			Body:   intent,
+			Operation: "CreateIntent",
+			Path:      intentPath,
+			Method:    http.MethodPost,
+			Body:      intent,
 		},
 	)
 
@@ -97,9 +106,10 @@ func (client *Client) UpdateIntent(id string, intent model.Intent) (model.QueryR
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   fmt.Sprintf("%s/%s", intentPath, id),
-			Method: http.MethodPut,
-			Body:   intent,
+			Operation: "UpdateIntent",
+			Path:      fmt.Sprintf("%s/%s", intentPath, id),
+			Method:    http.MethodPut,
+			Body:      intent,
 		},
 	)
 
@@ -123,8 +133,9 @@ func (client *Client) DeleteIntent(id string) (model.QueryResponse, error) {
 	request := newRequest(
 		client,
 		requestOptions{
-			Path:   fmt.Sprintf("%s/%s", intentPath, id),
-			Method: http.MethodDelete,
+			Operation: "DeleteIntent",
+			Path:      fmt.Sprintf("%s/%s", intentPath, id),
+			Method:    http.MethodDelete,
 		},
 	)
 
@@ -0,0 +1,322 @@
+package dialogflow
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// parameterReference matches $parameter references, e.g. $city or $city.original
+var parameterReference = regexp.MustCompile(`\$([A-Za-z_][A-Za-z0-9_-]*)`)
+
+// Severity ranks lint findings
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+var severityNames = []string{"info", "warning", "error"}
+
+func (severity Severity) String() string {
+	if severity < 0 || int(severity) >= len(severityNames) {
+		return fmt.Sprintf("severity(%d)", int(severity))
+	}
+	return severityNames[severity]
+}
+
+// MarshalText encodes the severity by name
+func (severity Severity) MarshalText() ([]byte, error) {
+	return []byte(severity.String()), nil
+}
+
+// UnmarshalText decodes a severity name
+func (severity *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if string(text) == name {
+			*severity = Severity(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Finding is a problem reported by a lint rule
+type Finding struct {
+	Rule     string   `json:"rule"`
+	Severity Severity `json:"severity"`
+	// Kind is either "intent" or "entity"
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Message string `json:"message"`
+}
+
+func (finding Finding) String() string {
+	return fmt.Sprintf("%s: %s %q: %s (%s)", finding.Severity, finding.Kind, finding.Name, finding.Message, finding.Rule)
+}
+
+// LintConfig configures a lint run
+type LintConfig struct {
+	// Disabled turns off the rules with the given names
+	Disabled map[string]bool
+	// MinTrainingPhrases is the fewest training phrases an intent may have, 5 if zero
+	MinTrainingPhrases int
+}
+
+// LintRule checks an agent for one kind of problem
+type LintRule struct {
+	Name     string
+	Severity Severity
+	Check    func(agent Agent, config LintConfig) []Finding
+}
+
+// LintRules are the rules run by Lint, in reporting order
+var LintRules = []LintRule{
+	{Name: "min-training-phrases", Severity: SeverityWarning, Check: lintMinTrainingPhrases},
+	{Name: "duplicate-training-phrase", Severity: SeverityError, Check: lintDuplicateTrainingPhrases},
+	{Name: "conflicting-synonym", Severity: SeverityError, Check: lintConflictingSynonyms},
+	{Name: "required-parameter-prompt", Severity: SeverityError, Check: lintRequiredParameterPrompts},
+	{Name: "unconsumed-output-context", Severity: SeverityWarning, Check: lintUnconsumedOutputContexts},
+	{Name: "unproduced-input-context", Severity: SeverityError, Check: lintUnproducedInputContexts},
+	{Name: "undefined-parameter-reference", Severity: SeverityError, Check: lintUndefinedParameters},
+	{Name: "no-response", Severity: SeverityWarning, Check: lintNoResponse},
+}
+
+// Lint runs every enabled rule over agent
+func Lint(agent Agent, config LintConfig) []Finding {
+	if config.MinTrainingPhrases <= 0 {
+		config.MinTrainingPhrases = 5
+	}
+
+	var findings []Finding
+	for _, rule := range LintRules {
+		if config.Disabled[rule.Name] {
+			continue
+		}
+
+		found := rule.Check(agent, config)
+		for i := range found {
+			found[i].Rule, found[i].Severity = rule.Name, rule.Severity
+		}
+		sort.SliceStable(found, func(i, j int) bool {
+			return found[i].Name < found[j].Name
+		})
+
+		findings = append(findings, found...)
+	}
+
+	return findings
+}
+
+// MaxSeverity returns the highest severity among findings, and false if there are none
+func MaxSeverity(findings []Finding) (Severity, bool) {
+	var max Severity
+	for _, finding := range findings {
+		if finding.Severity > max {
+			max = finding.Severity
+		}
+	}
+	return max, len(findings) > 0
+}
+
+// trainingPhrase returns the text of userSay
+func trainingPhrase(userSay model.UserSay) string {
+	var b strings.Builder
+	for _, data := range userSay.Data {
+		b.WriteString(data.Text)
+	}
+	return b.String()
+}
+
+func intentFinding(intent model.Intent, format string, args ...interface{}) Finding {
+	return Finding{Kind: "intent", Name: intent.Name, Message: fmt.Sprintf(format, args...)}
+}
+
+func lintMinTrainingPhrases(agent Agent, config LintConfig) []Finding {
+	var findings []Finding
+	for _, intent := range agent.Intents {
+		if intent.FallbackIntent || len(intent.Events) > 0 && len(intent.UserSays) == 0 {
+			continue
+		}
+		if len(intent.UserSays) < config.MinTrainingPhrases {
+			findings = append(findings, intentFinding(intent, "has %d training phrases, expected at least %d", len(intent.UserSays), config.MinTrainingPhrases))
+		}
+	}
+	return findings
+}
+
+func lintDuplicateTrainingPhrases(agent Agent, config LintConfig) []Finding {
+	owners := make(map[string][]string)
+	for _, intent := range agent.Intents {
+		seen := make(map[string]bool)
+		for _, userSay := range intent.UserSays {
+			phrase := strings.ToLower(strings.Join(strings.Fields(trainingPhrase(userSay)), " "))
+			if phrase != "" && !seen[phrase] {
+				seen[phrase] = true
+				owners[phrase] = append(owners[phrase], intent.Name)
+			}
+		}
+	}
+
+	phrases := make([]string, 0, len(owners))
+	for phrase := range owners {
+		phrases = append(phrases, phrase)
+	}
+	sort.Strings(phrases)
+
+	var findings []Finding
+	for _, phrase := range phrases {
+		intents := owners[phrase]
+		if len(intents) < 2 {
+			continue
+		}
+		for _, name := range intents {
+			findings = append(findings, Finding{Kind: "intent", Name: name, Message: fmt.Sprintf("training phrase %q is also used by %s", phrase, strings.Join(others(intents, name), ", "))})
+		}
+	}
+	return findings
+}
+
+// others returns names without name
+func others(names []string, name string) []string {
+	var rest []string
+	for _, n := range names {
+		if n != name {
+			rest = append(rest, n)
+		}
+	}
+	return rest
+}
+
+func lintConflictingSynonyms(agent Agent, config LintConfig) []Finding {
+	var findings []Finding
+	for _, entity := range agent.Entities {
+		values := make(map[string]string)
+		for _, entry := range entity.Entries {
+			for _, synonym := range entry.Synonyms {
+				key := strings.ToLower(synonym)
+				if previous, ok := values[key]; ok && previous != entry.Value {
+					findings = append(findings, Finding{Kind: "entity", Name: entity.Name, Message: fmt.Sprintf("synonym %q maps to both %q and %q", synonym, previous, entry.Value)})
+					continue
+				}
+				values[key] = entry.Value
+			}
+		}
+	}
+	return findings
+}
+
+func lintRequiredParameterPrompts(agent Agent, config LintConfig) []Finding {
+	var findings []Finding
+	for _, intent := range agent.Intents {
+		for _, response := range intent.Responses {
+			for _, parameter := range response.Parameters {
+				if parameter.Required && len(parameter.Prompts) == 0 {
+					findings = append(findings, intentFinding(intent, "required parameter %q has no prompts", parameter.Name))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// contextUsage returns the lower cased names of the contexts that intents take as input and set as output
+func contextUsage(agent Agent) (inputs, outputs map[string]bool) {
+	inputs, outputs = make(map[string]bool), make(map[string]bool)
+	for _, intent := range agent.Intents {
+		for _, context := range intent.Contexts {
+			inputs[strings.ToLower(context)] = true
+		}
+		for _, response := range intent.Responses {
+			for _, context := range response.AffectedContexts {
+				if context.Lifespan > 0 {
+					outputs[strings.ToLower(context.Name)] = true
+				}
+			}
+		}
+	}
+	return inputs, outputs
+}
+
+func lintUnconsumedOutputContexts(agent Agent, config LintConfig) []Finding {
+	inputs, _ := contextUsage(agent)
+
+	var findings []Finding
+	for _, intent := range agent.Intents {
+		for _, response := range intent.Responses {
+			for _, context := range response.AffectedContexts {
+				if context.Lifespan > 0 && !inputs[strings.ToLower(context.Name)] {
+					findings = append(findings, intentFinding(intent, "output context %q is never used as an input context", context.Name))
+				}
+			}
+		}
+	}
+	return findings
+}
+
+func lintUnproducedInputContexts(agent Agent, config LintConfig) []Finding {
+	_, outputs := contextUsage(agent)
+
+	var findings []Finding
+	for _, intent := range agent.Intents {
+		for _, context := range intent.Contexts {
+			if !outputs[strings.ToLower(context)] {
+				findings = append(findings, intentFinding(intent, "input context %q is never set by any intent", context))
+			}
+		}
+	}
+	return findings
+}
+
+func lintUndefinedParameters(agent Agent, config LintConfig) []Finding {
+	var findings []Finding
+	for _, intent := range agent.Intents {
+		defined := make(map[string]bool)
+		for _, response := range intent.Responses {
+			for _, parameter := range response.Parameters {
+				defined[parameter.Name] = true
+			}
+		}
+
+		reported := make(map[string]bool)
+		copied := copyIntent(intent)
+		texts(&copied, func(field *string, where string) {
+			for _, match := range parameterReference.FindAllStringSubmatch(*field, -1) {
+				if name := match[1]; !defined[name] && !reported[name] {
+					reported[name] = true
+					findings = append(findings, intentFinding(intent, "%s references undefined parameter $%s", where, name))
+				}
+			}
+		})
+	}
+	return findings
+}
+
+func lintNoResponse(agent Agent, config LintConfig) []Finding {
+	var findings []Finding
+	for _, intent := range agent.Intents {
+		if intent.WebhookUsed {
+			continue
+		}
+
+		responds := false
+		for _, response := range intent.Responses {
+			for _, message := range response.Messages {
+				// Cards, images, quick replies and payloads respond without speech
+				if message.Type != model.TextMessage || strings.TrimSpace(message.Speech) != "" {
+					responds = true
+				}
+			}
+		}
+
+		if !responds {
+			findings = append(findings, intentFinding(intent, "has no responses and does not use a webhook"))
+		}
+	}
+	return findings
+}
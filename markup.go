@@ -0,0 +1,236 @@
+package dialogflow
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// annotationPattern validates the inside of an annotation's parentheses
+var annotationPattern = regexp.MustCompile(`^(~)?(@[A-Za-z0-9_.-]+)?(?::([A-Za-z0-9_-]+))?$`)
+
+// MarkupError reports malformed training phrase markup
+type MarkupError struct {
+	// Line is the line of the phrase in a file, 0 when parsing a single phrase
+	Line int
+	// Column is the position of the offending character, in characters starting at 1
+	Column int
+	// Offset is the position of the offending character, in bytes starting at 0
+	Offset  int
+	Message string
+}
+
+func (err *MarkupError) Error() string {
+	if err.Line > 0 {
+		return fmt.Sprintf("line %d, column %d: %s", err.Line, err.Column, err.Message)
+	}
+	return fmt.Sprintf("column %d: %s", err.Column, err.Message)
+}
+
+// ParseUserSay parses a training phrase written in inline markup, e.g.
+//
+//	book a flight to [Paris](@sys.geo-city:destination) tomorrow
+//
+// Annotated text is enclosed in brackets and followed by the entity and alias in parentheses
+// The alias may be left out, and a leading ~ marks an annotation that is not user defined
+// A backslash escapes the next character, so \[ is a literal bracket
+func ParseUserSay(text string) (model.UserSay, error) {
+	var userSay model.UserSay
+	var plain strings.Builder
+
+	fail := func(offset int, format string, args ...interface{}) (model.UserSay, error) {
+		return model.UserSay{}, &MarkupError{
+			Column:  utf8.RuneCountInString(text[:offset]) + 1,
+			Offset:  offset,
+			Message: fmt.Sprintf(format, args...),
+		}
+	}
+
+	flush := func() {
+		if plain.Len() > 0 {
+			userSay.Data = append(userSay.Data, model.Data{Text: plain.String()})
+			plain.Reset()
+		}
+	}
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+
+		switch r {
+		case '\\':
+			if i+size >= len(text) {
+				return fail(i, "backslash at end of phrase")
+			}
+			escaped, escapedSize := utf8.DecodeRuneInString(text[i+size:])
+			plain.WriteRune(escaped)
+			i += size + escapedSize
+
+		case ']':
+			return fail(i, "unmatched ]")
+
+		case '[':
+			data, next, err := parseAnnotation(text, i)
+			if err != nil {
+				err.Column = utf8.RuneCountInString(text[:err.Offset]) + 1
+				return model.UserSay{}, err
+			}
+			flush()
+			userSay.Data = append(userSay.Data, data)
+			i = next
+
+		default:
+			plain.WriteRune(r)
+			i += size
+		}
+	}
+	flush()
+
+	if len(userSay.Data) == 0 {
+		return fail(0, "phrase is empty")
+	}
+
+	return userSay, nil
+}
+
+// parseAnnotation parses the annotation starting with the [ at start,
+// returning the annotated segment and the offset right after it
+func parseAnnotation(text string, start int) (model.Data, int, *MarkupError) {
+	var annotated strings.Builder
+	i := start + 1
+
+	for {
+		if i >= len(text) {
+			return model.Data{}, 0, &MarkupError{Offset: start, Message: "unclosed ["}
+		}
+
+		r, size := utf8.DecodeRuneInString(text[i:])
+		if r == ']' {
+			break
+		}
+
+		switch r {
+		case '[':
+			return model.Data{}, 0, &MarkupError{Offset: i, Message: "annotations cannot be nested"}
+		case '\\':
+			if i+size >= len(text) {
+				return model.Data{}, 0, &MarkupError{Offset: i, Message: "backslash at end of phrase"}
+			}
+			escaped, escapedSize := utf8.DecodeRuneInString(text[i+size:])
+			annotated.WriteRune(escaped)
+			i += size + escapedSize
+			continue
+		}
+
+		annotated.WriteRune(r)
+		i += size
+	}
+
+	if annotated.Len() == 0 {
+		return model.Data{}, 0, &MarkupError{Offset: start, Message: "annotated text is empty"}
+	}
+
+	closing := i
+	i++
+	if i >= len(text) || text[i] != '(' {
+		return model.Data{}, 0, &MarkupError{Offset: closing, Message: "expected (@entity:alias) after ]"}
+	}
+
+	end := strings.IndexByte(text[i:], ')')
+	if end < 0 {
+		return model.Data{}, 0, &MarkupError{Offset: i, Message: "unclosed ("}
+	}
+	annotation := text[i+1 : i+end]
+
+	match := annotationPattern.FindStringSubmatch(annotation)
+	if match == nil || match[2] == "" && match[3] == "" {
+		return model.Data{}, 0, &MarkupError{Offset: i + 1, Message: fmt.Sprintf("invalid annotation %q, expected @entity:alias", annotation)}
+	}
+
+	data := model.Data{
+		Text:        annotated.String(),
+		Meta:        match[2],
+		Alias:       match[3],
+		UserDefined: match[1] == "",
+	}
+
+	return data, i + end + 1, nil
+}
+
+// FormatUserSay writes userSay in the inline markup read by ParseUserSay
+func FormatUserSay(userSay model.UserSay) string {
+	var b strings.Builder
+
+	for i, data := range userSay.Data {
+		if data.Meta == "" && data.Alias == "" {
+			text := escapeMarkup(data.Text)
+			// ReadUserSays trims lines and skips those starting with #
+			if r, _ := utf8.DecodeRuneInString(text); i == 0 && (r == '#' || unicode.IsSpace(r)) {
+				text = `\` + text
+			}
+			b.WriteString(text)
+			continue
+		}
+
+		b.WriteString("[" + escapeMarkup(data.Text) + "](")
+		if !data.UserDefined {
+			b.WriteString("~")
+		}
+		b.WriteString(data.Meta)
+		if data.Alias != "" {
+			b.WriteString(":" + data.Alias)
+		}
+		b.WriteString(")")
+	}
+
+	return b.String()
+}
+
+func escapeMarkup(text string) string {
+	return strings.NewReplacer(`\`, `\\`, `[`, `\[`, `]`, `\]`).Replace(text)
+}
+
+// ReadUserSays parses a file with one training phrase per line
+// Blank lines and lines starting with # are skipped
+func ReadUserSays(r io.Reader) ([]model.UserSay, error) {
+	var userSays []model.UserSay
+
+	scanner := bufio.NewScanner(skipBOM(r))
+	for line := 1; scanner.Scan(); line++ {
+		raw := scanner.Text()
+		text := strings.TrimSpace(raw)
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		userSay, err := ParseUserSay(text)
+		if err != nil {
+			if markupErr, ok := err.(*MarkupError); ok {
+				indent := raw[:len(raw)-len(strings.TrimLeft(raw, " \t"))]
+				markupErr.Line = line
+				markupErr.Offset += len(indent)
+				markupErr.Column += utf8.RuneCountInString(indent)
+			}
+			return userSays, err
+		}
+		userSays = append(userSays, userSay)
+	}
+
+	return userSays, scanner.Err()
+}
+
+// WriteUserSays writes userSays in inline markup, one per line
+func WriteUserSays(w io.Writer, userSays []model.UserSay) error {
+	writer := bufio.NewWriter(w)
+
+	for _, userSay := range userSays {
+		writer.WriteString(FormatUserSay(userSay) + "\n")
+	}
+
+	return writer.Flush()
+}
@@ -0,0 +1,214 @@
+package dialogflow
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+func TestParseUserSay(t *testing.T) {
+	tests := []struct {
+		text string
+		want []model.Data
+	}{
+		{
+			"hello",
+			[]model.Data{{Text: "hello"}},
+		},
+		{
+			"book a flight to [Paris](@sys.geo-city:destination) tomorrow",
+			[]model.Data{
+				{Text: "book a flight to "},
+				{Text: "Paris", Meta: "@sys.geo-city", Alias: "destination", UserDefined: true},
+				{Text: " tomorrow"},
+			},
+		},
+		{
+			"[two](@sys.number)",
+			[]model.Data{{Text: "two", Meta: "@sys.number", UserDefined: true}},
+		},
+		{
+			"at [noon](~@sys.time:when)",
+			[]model.Data{
+				{Text: "at "},
+				{Text: "noon", Meta: "@sys.time", Alias: "when"},
+			},
+		},
+		{
+			"call me [Ada](:name)",
+			[]model.Data{
+				{Text: "call me "},
+				{Text: "Ada", Alias: "name", UserDefined: true},
+			},
+		},
+		{
+			`a \[literal\] bracket and a \\ backslash`,
+			[]model.Data{{Text: `a [literal] bracket and a \ backslash`}},
+		},
+		{
+			`[\[1\]](@ref)`,
+			[]model.Data{{Text: "[1]", Meta: "@ref", UserDefined: true}},
+		},
+		{
+			"[café](@place)[crème](@dish)",
+			[]model.Data{
+				{Text: "café", Meta: "@place", UserDefined: true},
+				{Text: "crème", Meta: "@dish", UserDefined: true},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		userSay, err := ParseUserSay(test.text)
+		if err != nil {
+			t.Errorf("%q: %v", test.text, err)
+			continue
+		}
+		if !reflect.DeepEqual(userSay.Data, test.want) {
+			t.Errorf("%q: got %+v, want %+v", test.text, userSay.Data, test.want)
+		}
+	}
+}
+
+func TestUserSayRoundTrip(t *testing.T) {
+	texts := []string{
+		"hello",
+		"book a flight to [Paris](@sys.geo-city:destination) tomorrow",
+		"at [noon](~@sys.time:when)",
+		"call me [Ada](:name)",
+		`a \[literal\] bracket and a \\ backslash`,
+		`[\[1\]](@ref)`,
+		"[café](@place)[crème](@dish)",
+		"(not) an annotation",
+	}
+
+	for _, text := range texts {
+		userSay, err := ParseUserSay(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		if formatted := FormatUserSay(userSay); formatted != text {
+			t.Errorf("%q: formatted as %q", text, formatted)
+		}
+	}
+}
+
+func TestFormatUserSayRoundTrip(t *testing.T) {
+	userSays := []model.UserSay{
+		{Data: []model.Data{{Text: "plain [text] with \\ escapes"}}},
+		{Data: []model.Data{{Text: "#1 pizza please"}}},
+		{Data: []model.Data{{Text: "  indented"}}},
+		{Data: []model.Data{{Text: "\ttabbed"}}},
+		{Data: []model.Data{
+			{Text: "from "},
+			{Text: "a]b", Meta: "@city", Alias: "from", UserDefined: true},
+			{Text: " to "},
+			{Text: "c[d", Meta: "@city", Alias: "to"},
+		}},
+	}
+
+	for _, userSay := range userSays {
+		text := FormatUserSay(userSay)
+		parsed, err := ParseUserSay(text)
+		if err != nil {
+			t.Errorf("%q: %v", text, err)
+			continue
+		}
+		if !reflect.DeepEqual(parsed.Data, userSay.Data) {
+			t.Errorf("%q: parsed as %+v, want %+v", text, parsed.Data, userSay.Data)
+		}
+	}
+
+	// Written files are trimmed and skip comments when read back
+	var buffer bytes.Buffer
+	if err := WriteUserSays(&buffer, userSays); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadUserSays(&buffer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(read, userSays) {
+		t.Errorf("file round trip got %+v, want %+v", read, userSays)
+	}
+}
+
+func TestParseUserSayErrors(t *testing.T) {
+	tests := []struct {
+		text   string
+		column int
+		offset int
+	}{
+		{"", 1, 0},
+		{"trailing \\", 10, 9},
+		{"a ] b", 3, 2},
+		{"an [unclosed bracket", 4, 3},
+		{"[nested [bracket]](@x)", 9, 8},
+		{"[](@x)", 1, 0},
+		{"[text] (@x)", 6, 5},
+		{"[text](@x", 7, 6},
+		{"[text](city)", 8, 7},
+		{"[text]()", 8, 7},
+		{"café [au lait", 6, 6},
+		{"naïve ]", 7, 7},
+	}
+
+	for _, test := range tests {
+		_, err := ParseUserSay(test.text)
+
+		var markupErr *MarkupError
+		if !errors.As(err, &markupErr) {
+			t.Errorf("%q: got %v, want a MarkupError", test.text, err)
+			continue
+		}
+		if markupErr.Line != 0 || markupErr.Column != test.column || markupErr.Offset != test.offset {
+			t.Errorf("%q: got line %d column %d offset %d, want line 0 column %d offset %d",
+				test.text, markupErr.Line, markupErr.Column, markupErr.Offset, test.column, test.offset)
+		}
+	}
+}
+
+func TestReadUserSays(t *testing.T) {
+	input := "\ufeff# greetings\n\nhello\n  hi [there](@who)\n"
+
+	userSays, err := ReadUserSays(strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userSays) != 2 {
+		t.Fatalf("got %d phrases, want 2", len(userSays))
+	}
+
+	var buffer bytes.Buffer
+	if err := WriteUserSays(&buffer, userSays); err != nil {
+		t.Fatal(err)
+	}
+	if want := "hello\nhi [there](@who)\n"; buffer.String() != want {
+		t.Errorf("got %q, want %q", buffer.String(), want)
+	}
+}
+
+func TestReadUserSaysErrorPosition(t *testing.T) {
+	input := "hello\n# comment\n\t  a [b](c)\n"
+
+	userSays, err := ReadUserSays(strings.NewReader(input))
+
+	var markupErr *MarkupError
+	if !errors.As(err, &markupErr) {
+		t.Fatalf("got %v, want a MarkupError", err)
+	}
+	if markupErr.Line != 3 || markupErr.Column != 10 || markupErr.Offset != 9 {
+		t.Errorf("got line %d column %d offset %d, want line 3 column 10 offset 9", markupErr.Line, markupErr.Column, markupErr.Offset)
+	}
+	if want := "line 3, column 10: "; !strings.HasPrefix(err.Error(), want) {
+		t.Errorf("got %q, want it to start with %q", err.Error(), want)
+	}
+	if len(userSays) != 1 {
+		t.Errorf("got %d phrases before the error, want 1", len(userSays))
+	}
+}
@@ -1,6 +1,27 @@
 package model
 
+// Message types of rich responses
+const (
+	TextMessage = iota
+	CardMessage
+	QuickRepliesMessage
+	ImageMessage
+	PayloadMessage
+)
+
 type Message struct {
-	Type   int    `json:"type,omitempty"`
-	Speech string `json:"speech,omitempty"`
+	Type     int                    `json:"type"`
+	Platform string                 `json:"platform,omitempty"`
+	Speech   string                 `json:"speech,omitempty"`
+	Title    string                 `json:"title,omitempty"`
+	Subtitle string                 `json:"subtitle,omitempty"`
+	ImageURL string                 `json:"imageUrl,omitempty"`
+	Buttons  []Button               `json:"buttons,omitempty"`
+	Replies  []string               `json:"replies,omitempty"`
+	Payload  map[string]interface{} `json:"payload,omitempty"`
+}
+
+type Button struct {
+	Text     string `json:"text,omitempty"`
+	Postback string `json:"postback,omitempty"`
 }
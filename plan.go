@@ -0,0 +1,262 @@
+package dialogflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// dryRunResponse is returned in place of the API response for recorded mutations
+var dryRunResponse = []byte(`{"status":{"code":200,"errorType":"success","errorDetails":"dry run"}}`)
+
+// PlanStep is a single mutation recorded while the client is in dry-run mode
+type PlanStep struct {
+	Operation string          `json:"operation"`
+	Method    string          `json:"method"`
+	Path      string          `json:"path"`
+	SessionID string          `json:"sessionId,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+}
+
+// Resource returns the kind of resource the step mutates (intents, entities, ...)
+func (step PlanStep) Resource() string {
+	return strings.SplitN(step.Path, "/", 2)[0]
+}
+
+// ResourceID returns the ID or name of the mutated resource, if the step addresses one
+func (step PlanStep) ResourceID() string {
+	parts := strings.Split(step.Path, "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// entityID matches the generated IDs of entities, as opposed to their names
+var entityID = regexp.MustCompile(`^[0-9a-fA-F]{8}(-[0-9a-fA-F]{4}){3}-[0-9a-fA-F]{12}$`)
+
+// entityNames returns the names of the entities in the step's body, which holds
+// either one entity or an array of them
+func (step PlanStep) entityNames() []string {
+	var entities []model.Entity
+	if json.Unmarshal(step.Body, &entities) != nil {
+		var entity model.Entity
+		json.Unmarshal(step.Body, &entity)
+		entities = []model.Entity{entity}
+	}
+
+	var names []string
+	for _, entity := range entities {
+		if entity.Name != "" {
+			names = append(names, entity.Name)
+		}
+	}
+	return names
+}
+
+// createdEntities returns the names of the entities the step may create,
+// with CreateEntity or UpdateEntities
+func (step PlanStep) createdEntities() []string {
+	if step.Path != entityPath || step.Method != http.MethodPost && step.Method != http.MethodPut {
+		return nil
+	}
+	return step.entityNames()
+}
+
+// touches reports whether the step may mutate the entity called name
+// Steps addressing an entity by its generated ID may mutate any entity
+func (step PlanStep) touches(name string) bool {
+	if step.Resource() != entityPath {
+		return false
+	}
+	if id := step.ResourceID(); id == name || entityID.MatchString(id) {
+		return true
+	}
+	return containsString(step.entityNames(), name)
+}
+
+// references reports whether the step's body references the entity called name
+func (step PlanStep) references(name string) bool {
+	for _, match := range entityReference.FindAllStringSubmatch(string(step.Body), -1) {
+		if strings.TrimRight(match[1], ".") == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan is a serializable list of mutations recorded in dry-run mode
+type Plan struct {
+	Steps []PlanStep `json:"steps"`
+}
+
+// Ordered returns a copy of the plan in which entity creates, by CreateEntity or
+// UpdateEntities, are moved ahead of the intent steps that reference the entity,
+// directly or through a composite entity created in the plan
+// Every other step keeps the order in which it was recorded, and entity creates never
+// move past another step on the same entity or on an entity they reference, so that e.g.
+// a delete followed by a create of the same entity still runs in that order
+func (plan Plan) Ordered() Plan {
+	steps := make([]PlanStep, len(plan.Steps))
+	copy(steps, plan.Steps)
+
+	creators := make(map[string]PlanStep)
+	for _, step := range steps {
+		for _, name := range step.createdEntities() {
+			creators[name] = step
+		}
+	}
+
+	// needs reports whether step references name, directly or through composite
+	// entities created in the plan
+	var needs func(step PlanStep, name string, seen map[string]bool) bool
+	needs = func(step PlanStep, name string, seen map[string]bool) bool {
+		if step.references(name) {
+			return true
+		}
+		for created, creator := range creators {
+			if !seen[created] && step.references(created) {
+				seen[created] = true
+				if needs(creator, name, seen) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+
+	for i := range steps {
+		names := steps[i].createdEntities()
+		if len(names) == 0 {
+			continue
+		}
+
+		target := i
+		for j := i - 1; j >= 0 && !steps[i].dependsOn(steps[j], names); j-- {
+			if steps[j].Resource() != intentPath {
+				continue
+			}
+			for _, name := range names {
+				if needs(steps[j], name, make(map[string]bool)) {
+					target = j
+				}
+			}
+		}
+
+		if target < i {
+			step := steps[i]
+			copy(steps[target+1:i+1], steps[target:i])
+			steps[target] = step
+		}
+	}
+
+	return Plan{Steps: steps}
+}
+
+// dependsOn reports whether the step creating the entities called names must stay after
+// earlier, because earlier mutates one of those entities or one the step references
+func (step PlanStep) dependsOn(earlier PlanStep, names []string) bool {
+	for _, name := range names {
+		if earlier.touches(name) {
+			return true
+		}
+	}
+	for _, name := range earlier.createdEntities() {
+		if step.references(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// StepResult is the outcome of applying a single plan step
+type StepResult struct {
+	Step     PlanStep
+	Response model.QueryResponse
+	Err      error
+}
+
+// GetPlan returns the mutations recorded so far in dry-run mode
+func (client *Client) GetPlan() Plan {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	steps := make([]PlanStep, len(client.plan.Steps))
+	copy(steps, client.plan.Steps)
+	return Plan{Steps: steps}
+}
+
+// ResetPlan discards all recorded mutations
+func (client *Client) ResetPlan() {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+	client.plan = Plan{}
+}
+
+// ApplyPlan sends the mutations of plan in the order given by Ordered, regardless of dry-run mode
+// It stops at the first step that fails and returns the results of every step attempted
+func (client *Client) ApplyPlan(plan Plan) ([]StepResult, error) {
+	var results []StepResult
+
+	if len(plan.Steps) == 0 {
+		return results, errors.New("plan cannot be empty")
+	}
+
+	for _, step := range plan.Ordered().Steps {
+		result := StepResult{Step: step}
+
+		request := newRequest(
+			client,
+			requestOptions{
+				Operation: step.Operation,
+				Path:      step.Path,
+				SessionID: step.SessionID,
+				Method:    step.Method,
+				Body:      step.Body,
+			},
+		)
+		request.dryRun = false
+
+		data, err := request.perform()
+		if err == nil {
+			err = json.Unmarshal(data, &result.Response)
+		}
+		if err == nil {
+			err = statusError(result.Response.Status)
+		}
+
+		result.Err = err
+		results = append(results, result)
+		if err != nil {
+			return results, fmt.Errorf("step %s %s failed: %v", step.Operation, step.Path, err)
+		}
+	}
+
+	return results, nil
+}
+
+// record appends the request to the client's plan instead of sending it
+func (r *request) record() ([]byte, error) {
+	body, err := r.encodedBody()
+	if err != nil {
+		return nil, err
+	}
+
+	r.client.mu.Lock()
+	defer r.client.mu.Unlock()
+
+	r.client.plan.Steps = append(r.client.plan.Steps, PlanStep{
+		Operation: r.operation,
+		Method:    r.Method,
+		Path:      r.path,
+		SessionID: r.sessionID,
+		Body:      body,
+	})
+
+	return dryRunResponse, nil
+}
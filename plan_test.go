@@ -0,0 +1,144 @@
+package dialogflow
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// cityIntent is an intent whose training phrase is annotated with @city
+var cityIntent = model.Intent{
+	Name: "travel",
+	UserSays: []model.UserSay{{Data: []model.Data{
+		{Text: "go to "},
+		{Text: "paris", Meta: "@city", Alias: "city", UserDefined: true},
+	}}},
+}
+
+// operations returns the operation and addressed resource of every step of plan
+func operations(plan Plan) []string {
+	var operations []string
+	for _, step := range plan.Steps {
+		operation := step.Operation
+		if names := step.entityNames(); len(names) > 0 && step.Resource() == entityPath {
+			operation += " " + names[0]
+		} else if id := step.ResourceID(); id != "" {
+			operation += " " + id
+		}
+		operations = append(operations, operation)
+	}
+	return operations
+}
+
+func TestPlanOrdered(t *testing.T) {
+	city := model.Entity{Name: "city", Entries: []model.Entry{{Value: "paris"}}}
+	composite := model.Entity{Name: "trip", Entries: []model.Entry{{Value: "@city:from to @city:to"}}}
+	cityNameIntent := model.Intent{
+		Name:     "name",
+		UserSays: []model.UserSay{{Data: []model.Data{{Text: "x", Meta: "@cityname", UserDefined: true}}}},
+	}
+
+	tests := []struct {
+		name   string
+		record func(client *Client)
+		want   []string
+	}{
+		{
+			name: "create entity after referencing intent",
+			record: func(client *Client) {
+				client.CreateIntent(cityIntent)
+				client.CreateEntity(city)
+			},
+			want: []string{"CreateEntity city", "CreateIntent"},
+		},
+		{
+			name: "update entities after referencing intent",
+			record: func(client *Client) {
+				client.CreateIntent(cityIntent)
+				client.UpdateEntities([]model.Entity{{Name: "color"}, city})
+			},
+			want: []string{"UpdateEntities color", "CreateIntent"},
+		},
+		{
+			name: "create entity past a step on another entity",
+			record: func(client *Client) {
+				client.CreateIntent(cityIntent)
+				client.DeleteEntity("other")
+				client.CreateEntity(city)
+			},
+			want: []string{"CreateEntity city", "CreateIntent", "DeleteEntity other"},
+		},
+		{
+			name: "create entity stays after a delete of the same entity",
+			record: func(client *Client) {
+				client.CreateIntent(cityIntent)
+				client.DeleteEntity("city")
+				client.CreateEntity(city)
+			},
+			want: []string{"CreateIntent", "DeleteEntity city", "CreateEntity city"},
+		},
+		{
+			name: "create entity stays after a step addressing an entity by ID",
+			record: func(client *Client) {
+				client.CreateIntent(cityIntent)
+				client.DeleteEntity("6d5f3a1e-2b4c-4d8e-9f0a-1b2c3d4e5f60")
+				client.CreateEntity(city)
+			},
+			want: []string{"CreateIntent", "DeleteEntity 6d5f3a1e-2b4c-4d8e-9f0a-1b2c3d4e5f60", "CreateEntity city"},
+		},
+		{
+			name: "composite entity stays after the entity it references",
+			record: func(client *Client) {
+				client.CreateIntent(model.Intent{
+					Name:     "book",
+					UserSays: []model.UserSay{{Data: []model.Data{{Text: "x", Meta: "@trip", UserDefined: true}}}},
+				})
+				client.CreateEntity(city)
+				client.CreateEntity(composite)
+			},
+			want: []string{"CreateEntity city", "CreateEntity trip", "CreateIntent"},
+		},
+		{
+			name: "delete and recreate of an intent keep their order",
+			record: func(client *Client) {
+				client.DeleteIntent("travel")
+				client.CreateIntent(cityIntent)
+			},
+			want: []string{"DeleteIntent travel", "CreateIntent"},
+		},
+		{
+			name: "longer entity names are not references",
+			record: func(client *Client) {
+				client.CreateIntent(cityNameIntent)
+				client.CreateEntity(city)
+			},
+			want: []string{"CreateIntent", "CreateEntity city"},
+		},
+		{
+			name: "unrelated steps keep their order",
+			record: func(client *Client) {
+				client.DeleteIntent("a")
+				client.CreateIntent(cityIntent)
+				client.DeleteIntent("b")
+				client.CreateEntity(city)
+				client.DeleteIntent("c")
+			},
+			want: []string{"DeleteIntent a", "CreateEntity city", "CreateIntent", "DeleteIntent b", "DeleteIntent c"},
+		},
+	}
+
+	for _, test := range tests {
+		client := NewClient("token")
+		client.SetDryRun(true)
+		test.record(client)
+
+		plan := client.GetPlan()
+		if got := operations(plan.Ordered()); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+		if len(client.GetPlan().Steps) != len(plan.Steps) || !reflect.DeepEqual(client.GetPlan(), plan) {
+			t.Errorf("%s: Ordered changed the recorded plan", test.name)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package dialogflow
+
+import (
+	"sync"
+	"time"
+)
+
+// rateLimiter spaces out requests so that no more than one is sent per interval
+type rateLimiter struct {
+	mu       sync.Mutex
+	interval time.Duration
+	next     time.Time
+}
+
+// setInterval changes the minimum delay between requests, 0 disables limiting
+func (limiter *rateLimiter) setInterval(interval time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+	limiter.interval = interval
+	limiter.next = time.Time{}
+}
+
+// wait blocks until the caller may send its request
+func (limiter *rateLimiter) wait() {
+	limiter.mu.Lock()
+	if limiter.interval <= 0 {
+		limiter.mu.Unlock()
+		return
+	}
+
+	now := time.Now()
+	if limiter.next.Before(now) {
+		limiter.next = now
+	}
+	delay := limiter.next.Sub(now)
+	limiter.next = limiter.next.Add(limiter.interval)
+	limiter.mu.Unlock()
+
+	time.Sleep(delay)
+}
@@ -0,0 +1,303 @@
+package dialogflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// RefactorChange is the rewrite of a single intent or entity
+type RefactorChange struct {
+	// Kind is either "intent" or "entity"
+	Kind string `json:"kind"`
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Edits describes every rewritten reference, for review
+	Edits  []string      `json:"edits"`
+	Intent *model.Intent `json:"intent,omitempty"`
+	Entity *model.Entity `json:"entity,omitempty"`
+}
+
+// RefactorPlan is the set of rewrites a refactoring applies to an agent
+type RefactorPlan struct {
+	Description string           `json:"description"`
+	Changes     []RefactorChange `json:"changes"`
+}
+
+func (plan RefactorPlan) String() string {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "%s: %d changes\n", plan.Description, len(plan.Changes))
+	for _, change := range plan.Changes {
+		fmt.Fprintf(&b, "  %s %q\n", change.Kind, change.Name)
+		for _, edit := range change.Edits {
+			fmt.Fprintf(&b, "    %s\n", edit)
+		}
+	}
+
+	return b.String()
+}
+
+// ApplyRefactor sends the rewritten entities and then the rewritten intents of plan
+// In dry-run mode the updates are recorded into the client's plan instead
+func (client *Client) ApplyRefactor(plan RefactorPlan) error {
+	for _, kind := range []string{"entity", "intent"} {
+		for _, change := range plan.Changes {
+			if change.Kind != kind {
+				continue
+			}
+
+			var response model.QueryResponse
+			var err error
+			if change.Entity != nil {
+				response, err = client.UpdateEntity(change.ID, *change.Entity)
+			} else {
+				response, err = client.UpdateIntent(change.ID, *change.Intent)
+			}
+			if err == nil {
+				err = statusError(response.Status)
+			}
+			if err != nil {
+				return fmt.Errorf("%s %q: %v", change.Kind, change.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// rewriter collects the edits made to a single intent or entity
+type rewriter struct {
+	edits []string
+}
+
+// set replaces *field with to if it equals from, describing the edit as where
+func (rw *rewriter) set(field *string, from, to, where string, fold bool) {
+	if *field == from || (fold && strings.EqualFold(*field, from)) {
+		rw.edits = append(rw.edits, fmt.Sprintf("%s: %q -> %q", where, *field, to))
+		*field = to
+	}
+}
+
+// replace rewrites every match of pattern in *field using replacement
+func (rw *rewriter) replace(field *string, pattern *regexp.Regexp, replacement, where string) {
+	if rewritten := pattern.ReplaceAllString(*field, replacement); rewritten != *field {
+		rw.edits = append(rw.edits, fmt.Sprintf("%s: %q -> %q", where, *field, rewritten))
+		*field = rewritten
+	}
+}
+
+// texts calls fn for every free text of intent that may hold $parameter or #context.parameter references
+func texts(intent *model.Intent, fn func(field *string, where string)) {
+	for r := range intent.Responses {
+		response := &intent.Responses[r]
+		for p := range response.Parameters {
+			parameter := &response.Parameters[p]
+			fn(&parameter.Value, fmt.Sprintf("parameter %s value", parameter.Name))
+			fn(&parameter.DefaultValue, fmt.Sprintf("parameter %s default value", parameter.Name))
+			for i := range parameter.Prompts {
+				fn(&parameter.Prompts[i], fmt.Sprintf("parameter %s prompt %d", parameter.Name, i+1))
+			}
+		}
+		for m := range response.Messages {
+			fn(&response.Messages[m].Speech, fmt.Sprintf("message %d", m+1))
+		}
+	}
+}
+
+// copyIntent returns a deep copy of intent
+func copyIntent(intent model.Intent) model.Intent {
+	var copied model.Intent
+	data, _ := json.Marshal(intent)
+	json.Unmarshal(data, &copied)
+	copied.ID = intent.ID
+	return copied
+}
+
+// copyEntity returns a deep copy of entity
+func copyEntity(entity model.Entity) model.Entity {
+	var copied model.Entity
+	data, _ := json.Marshal(entity)
+	json.Unmarshal(data, &copied)
+	return copied
+}
+
+func (plan *RefactorPlan) addIntent(intent model.Intent, rw *rewriter) {
+	if len(rw.edits) > 0 {
+		plan.Changes = append(plan.Changes, RefactorChange{Kind: "intent", ID: intent.ID, Name: intent.Name, Edits: rw.edits, Intent: &intent})
+	}
+}
+
+func (plan *RefactorPlan) addEntity(entity model.Entity, rw *rewriter) {
+	if len(rw.edits) > 0 {
+		plan.Changes = append(plan.Changes, RefactorChange{Kind: "entity", ID: entity.ID, Name: entity.Name, Edits: rw.edits, Entity: &entity})
+	}
+}
+
+// RenameEntity plans renaming the entity named from to to, along with the training phrase
+// annotations, parameter data types and composite entity entries that refer to it
+func RenameEntity(agent Agent, from, to string) (RefactorPlan, error) {
+	plan := RefactorPlan{Description: fmt.Sprintf("rename entity @%s to @%s", from, to)}
+
+	if from == "" || to == "" || from == to {
+		return plan, errors.New("from and to must be different and not empty")
+	}
+	if _, ok := agent.Entity(from); !ok {
+		return plan, fmt.Errorf("entity %q: %w", from, ErrNotFound)
+	}
+	if _, ok := agent.Entity(to); ok {
+		return plan, fmt.Errorf("entity %q already exists", to)
+	}
+
+	// The reference ends at a character that cannot continue an entity name, which is kept,
+	// so @city does not match inside @city-name or @city.district
+	composite := regexp.MustCompile(`@` + regexp.QuoteMeta(from) + `(\.?(?:[^A-Za-z0-9_.-]|$))`)
+
+	for _, original := range agent.Entities {
+		entity, rw := copyEntity(original), &rewriter{}
+
+		rw.set(&entity.Name, from, to, "name", false)
+		for e := range entity.Entries {
+			entry := &entity.Entries[e]
+			rw.replace(&entry.Value, composite, "@"+to+"$1", "entry value")
+			for s := range entry.Synonyms {
+				rw.replace(&entry.Synonyms[s], composite, "@"+to+"$1", fmt.Sprintf("entry %s synonym", entry.Value))
+			}
+		}
+
+		plan.addEntity(entity, rw)
+	}
+
+	for _, original := range agent.Intents {
+		intent, rw := copyIntent(original), &rewriter{}
+
+		for u := range intent.UserSays {
+			for d := range intent.UserSays[u].Data {
+				rw.set(&intent.UserSays[u].Data[d].Meta, "@"+from, "@"+to, fmt.Sprintf("training phrase %d annotation", u+1), false)
+			}
+		}
+		for r := range intent.Responses {
+			for p := range intent.Responses[r].Parameters {
+				parameter := &intent.Responses[r].Parameters[p]
+				rw.set(&parameter.DataType, "@"+from, "@"+to, fmt.Sprintf("parameter %s data type", parameter.Name), false)
+			}
+		}
+
+		plan.addIntent(intent, rw)
+	}
+
+	return plan, nil
+}
+
+// RenameContext plans renaming the context from to to in the input and output contexts
+// of every intent and in #context.parameter references
+// Context names are case insensitive
+func RenameContext(agent Agent, from, to string) (RefactorPlan, error) {
+	plan := RefactorPlan{Description: fmt.Sprintf("rename context %s to %s", from, to)}
+
+	if from == "" || to == "" || strings.EqualFold(from, to) {
+		return plan, errors.New("from and to must be different and not empty")
+	}
+
+	reference := regexp.MustCompile(`(?i)#` + regexp.QuoteMeta(from) + `\.`)
+
+	for _, original := range agent.Intents {
+		intent, rw := copyIntent(original), &rewriter{}
+
+		for c := range intent.Contexts {
+			rw.set(&intent.Contexts[c], from, to, "input context", true)
+		}
+		for r := range intent.Responses {
+			for c := range intent.Responses[r].AffectedContexts {
+				rw.set(&intent.Responses[r].AffectedContexts[c].Name, from, to, "output context", true)
+			}
+		}
+		texts(&intent, func(field *string, where string) {
+			rw.replace(field, reference, "#"+to+".", where)
+		})
+
+		plan.addIntent(intent, rw)
+	}
+
+	return plan, nil
+}
+
+// RenameParameter plans renaming the parameter from to to in the intent named intent,
+// along with its training phrase aliases and $parameter references, and the
+// #context.parameter references to it in every intent
+// An empty intent renames the parameter in all intents
+func RenameParameter(agent Agent, intent, from, to string) (RefactorPlan, error) {
+	plan := RefactorPlan{Description: fmt.Sprintf("rename parameter $%s to $%s", from, to)}
+
+	if from == "" || to == "" || from == to {
+		return plan, errors.New("from and to must be different and not empty")
+	}
+	if intent != "" {
+		if _, ok := agent.Intent(intent); !ok {
+			return plan, fmt.Errorf("intent %q: %w", intent, ErrNotFound)
+		}
+		plan.Description += " in intent " + intent
+	}
+
+	// The reference ends at a character that cannot continue a parameter name, which is kept,
+	// so $city does not match inside $city-name
+	local := regexp.MustCompile(`\$` + regexp.QuoteMeta(from) + `([^A-Za-z0-9_-]|$)`)
+
+	// #context.parameter references follow the contexts set by the renamed intents
+	contexts := make(map[string]bool)
+	for _, candidate := range agent.Intents {
+		if intent != "" && candidate.Name != intent {
+			continue
+		}
+		for _, response := range candidate.Responses {
+			for _, context := range response.AffectedContexts {
+				contexts[strings.ToLower(context.Name)] = true
+			}
+		}
+	}
+
+	var names []string
+	for name := range contexts {
+		names = append(names, regexp.QuoteMeta(name))
+	}
+	contextual := regexp.MustCompile(`(?i)(#[A-Za-z0-9_-]+)\.` + regexp.QuoteMeta(from) + `([^A-Za-z0-9_-]|$)`)
+	if intent != "" {
+		contextual = regexp.MustCompile(`(?i)(#(?:` + strings.Join(names, "|") + `))\.` + regexp.QuoteMeta(from) + `([^A-Za-z0-9_-]|$)`)
+	}
+
+	for _, original := range agent.Intents {
+		renamed, rw := copyIntent(original), &rewriter{}
+		inScope := intent == "" || original.Name == intent
+
+		if inScope {
+			for u := range renamed.UserSays {
+				for d := range renamed.UserSays[u].Data {
+					rw.set(&renamed.UserSays[u].Data[d].Alias, from, to, fmt.Sprintf("training phrase %d alias", u+1), false)
+				}
+			}
+			for r := range renamed.Responses {
+				for p := range renamed.Responses[r].Parameters {
+					rw.set(&renamed.Responses[r].Parameters[p].Name, from, to, "parameter name", false)
+				}
+			}
+		}
+
+		texts(&renamed, func(field *string, where string) {
+			if inScope {
+				// $$ is a literal dollar sign in the replacement
+				rw.replace(field, local, "$$"+to+"$1", where)
+			}
+			if len(names) > 0 || intent == "" {
+				rw.replace(field, contextual, "$1."+to+"$2", where)
+			}
+		})
+
+		plan.addIntent(renamed, rw)
+	}
+
+	return plan, nil
+}
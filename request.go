@@ -3,17 +3,23 @@ package dialogflow
 import (
 	"bytes"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/url"
+
+	"github.com/kompiuter/go-dialogflow/model"
 )
 
 type requestOptions struct {
+	Operation   string
 	Path        string
 	SessionID   string
 	Method      string
 	Body        interface{}
 	QueryParams map[string]string
+	// NoSnapshot skips the snapshot taken before mutations, for callers that take their own
+	NoSnapshot bool
 }
 
 type request struct {
@@ -22,6 +28,13 @@ type request struct {
 	Headers     map[string]string
 	Body        interface{}
 	QueryParams map[string]string
+
+	client     *Client
+	operation  string
+	path       string
+	sessionID  string
+	dryRun     bool
+	noSnapshot bool
 }
 
 func newRequest(client *Client, options requestOptions) *request {
@@ -37,16 +50,56 @@ func newRequest(client *Client, options requestOptions) *request {
 		Headers:     headers,
 		QueryParams: options.QueryParams,
 		Body:        options.Body,
+		client:      client,
+		operation:   options.Operation,
+		path:        options.Path,
+		sessionID:   options.SessionID,
+		dryRun:      client.IsDryRun(),
+		noSnapshot:  options.NoSnapshot,
 	}
 
 	return req
 }
 
-// Perform executes the HTTP request
+// Perform executes the HTTP request, or records it in the client's plan
+// if it is a mutation issued in dry-run mode
+// Only mutations carry an operation name, so queries are always sent
 func (r *request) perform() ([]byte, error) {
+	if r.operation == "" {
+		return r.send()
+	}
+
+	if r.dryRun {
+		return r.record()
+	}
+
+	if err := r.snapshot(); err != nil {
+		return nil, fmt.Errorf("could not snapshot before %s: %v", r.operation, err)
+	}
+
+	data, err := r.send()
+	r.client.index.invalidate(r.path)
+	r.audit(data, err)
+
+	return data, err
+}
+
+// encodedBody returns the JSON encoding of the request body, or nil if there is none
+func (r *request) encodedBody() (json.RawMessage, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(r.Body)
+}
+
+// Send executes the HTTP request unconditionally
+func (r *request) send() ([]byte, error) {
 	var data []byte
 	client := &http.Client{}
 
+	r.client.limiter.wait()
+
 	req, err := http.NewRequest(r.Method, r.URI, nil)
 
 	if r.Method != http.MethodGet {
@@ -88,3 +141,12 @@ func prepare(client *Client, path, session string) string {
 
 	return client.GetBaseURL() + path + "?" + m.Encode()
 }
+
+// statusError returns an error describing status if it reports a failure
+func statusError(status model.Status) error {
+	if status.Code < http.StatusBadRequest {
+		return nil
+	}
+
+	return fmt.Errorf("%d %s: %s", status.Code, status.ErrorType, status.ErrorDetails)
+}
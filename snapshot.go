@@ -0,0 +1,290 @@
+package dialogflow
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// Snapshot is the content of agent resources captured before they were mutated
+type Snapshot struct {
+	ID        string         `json:"id"`
+	CreatedAt time.Time      `json:"createdAt"`
+	Operation string         `json:"operation,omitempty"`
+	Intents   []model.Intent `json:"intents,omitempty"`
+	Entities  []model.Entity `json:"entities,omitempty"`
+}
+
+// SnapshotStore persists snapshots
+type SnapshotStore interface {
+	// Save stores snapshot under its ID
+	Save(snapshot Snapshot) error
+	// Load returns the snapshot with ID id
+	Load(id string) (Snapshot, error)
+	// List returns the IDs of all stored snapshots, oldest first
+	List() ([]string, error)
+}
+
+// FileSnapshotStore stores snapshots as JSON files in a directory
+type FileSnapshotStore struct {
+	dir string
+}
+
+// NewFileSnapshotStore creates a snapshot store in dir, creating the directory if needed
+func NewFileSnapshotStore(dir string) (*FileSnapshotStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir cannot be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileSnapshotStore{dir: dir}, nil
+}
+
+// Save writes snapshot to <dir>/<id>.json
+func (store *FileSnapshotStore) Save(snapshot Snapshot) error {
+	if snapshot.ID == "" {
+		return errors.New("snapshot id cannot be empty")
+	}
+
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := store.path(snapshot.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, store.path(snapshot.ID))
+}
+
+// Load reads the snapshot with ID id
+func (store *FileSnapshotStore) Load(id string) (Snapshot, error) {
+	var snapshot Snapshot
+
+	if id == "" || strings.ContainsAny(id, `/\`) {
+		return snapshot, fmt.Errorf("invalid snapshot id %q", id)
+	}
+
+	data, err := ioutil.ReadFile(store.path(id))
+	if err != nil {
+		return snapshot, err
+	}
+
+	err = json.Unmarshal(data, &snapshot)
+	return snapshot, err
+}
+
+// List returns the IDs of the stored snapshots, oldest first
+func (store *FileSnapshotStore) List() ([]string, error) {
+	files, err := ioutil.ReadDir(store.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, file := range files {
+		if !file.IsDir() && filepath.Ext(file.Name()) == ".json" {
+			ids = append(ids, strings.TrimSuffix(file.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+func (store *FileSnapshotStore) path(id string) string {
+	return filepath.Join(store.dir, id+".json")
+}
+
+// newSnapshotID returns an ID that sorts in creation order
+func newSnapshotID(now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+
+	return now.UTC().Format("20060102T150405.000000000Z") + "-" + hex.EncodeToString(suffix)
+}
+
+// Snapshot captures the current content of the given intents and entities
+// and returns the ID of the stored snapshot
+func (client *Client) Snapshot(intentIDs, entityIDs []string) (string, error) {
+	store := client.GetSnapshotStore()
+	if store == nil {
+		return "", errors.New("client has no snapshot store")
+	}
+
+	if len(intentIDs) == 0 && len(entityIDs) == 0 {
+		return "", errors.New("intentIDs and entityIDs cannot both be empty")
+	}
+
+	snapshot, err := client.capture("Snapshot", intentIDs, entityIDs)
+	if err != nil {
+		return "", err
+	}
+
+	return snapshot.ID, store.Save(snapshot)
+}
+
+// Rollback restores the intents and entities captured in the snapshot with ID id
+// Resources that no longer exist are recreated
+func (client *Client) Rollback(id string) error {
+	store := client.GetSnapshotStore()
+	if store == nil {
+		return errors.New("client has no snapshot store")
+	}
+
+	snapshot, err := store.Load(id)
+	if err != nil {
+		return err
+	}
+
+	for _, entity := range snapshot.Entities {
+		response, err := client.UpdateEntity(entity.ID, entity)
+		if err == nil && response.Status.Code == http.StatusNotFound {
+			entity.ID = ""
+			response, err = client.CreateEntity(entity)
+		}
+		if err == nil {
+			err = statusError(response.Status)
+		}
+		if err != nil {
+			return fmt.Errorf("could not restore entity %s: %v", entity.Name, err)
+		}
+	}
+
+	for _, intent := range snapshot.Intents {
+		response, err := client.UpdateIntent(intent.ID, intent)
+		if err == nil && response.Status.Code == http.StatusNotFound {
+			intent.ID = ""
+			response, err = client.CreateIntent(intent)
+		}
+		if err == nil {
+			err = statusError(response.Status)
+		}
+		if err != nil {
+			return fmt.Errorf("could not restore intent %s: %v", intent.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// capture fetches the given intents and entities, skipping those that do not exist
+func (client *Client) capture(operation string, intentIDs, entityIDs []string) (Snapshot, error) {
+	now := time.Now()
+	snapshot := Snapshot{
+		ID:        newSnapshotID(now),
+		CreatedAt: now,
+		Operation: operation,
+	}
+
+	for _, id := range intentIDs {
+		intent, err := client.GetIntent(id)
+		if err != nil {
+			return snapshot, err
+		}
+		if intent.ID != "" {
+			snapshot.Intents = append(snapshot.Intents, intent)
+		}
+	}
+
+	for _, id := range entityIDs {
+		entity, err := client.GetEntity(id)
+		if err != nil {
+			return snapshot, err
+		}
+		if entity.ID != "" {
+			snapshot.Entities = append(snapshot.Entities, entity)
+		}
+	}
+
+	return snapshot, nil
+}
+
+// snapshot saves the current state of the resources the request is about to mutate
+func (r *request) snapshot() error {
+	store := r.client.GetSnapshotStore()
+	if store == nil || r.noSnapshot {
+		return nil
+	}
+
+	var intentIDs, entityIDs []string
+
+	parts := strings.Split(r.path, "/")
+	switch {
+	case parts[0] == intentPath && len(parts) > 1:
+		intentIDs = append(intentIDs, parts[1])
+	case parts[0] == entityPath && len(parts) > 1:
+		entityIDs = append(entityIDs, parts[1])
+	case parts[0] == entityPath && r.Method == http.MethodPut:
+		ids, err := r.existingEntityIDs()
+		if err != nil {
+			return err
+		}
+		entityIDs = append(entityIDs, ids...)
+	}
+
+	if len(intentIDs) == 0 && len(entityIDs) == 0 {
+		return nil
+	}
+
+	snapshot, err := r.client.capture(r.operation, intentIDs, entityIDs)
+	if err != nil {
+		return err
+	}
+
+	if len(snapshot.Intents) == 0 && len(snapshot.Entities) == 0 {
+		return nil
+	}
+
+	return store.Save(snapshot)
+}
+
+// existingEntityIDs resolves the IDs of the already existing entities in a bulk update body
+func (r *request) existingEntityIDs() ([]string, error) {
+	var entities []model.Entity
+
+	data, err := json.Marshal(r.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entities); err != nil {
+		return nil, err
+	}
+
+	all, err := r.client.GetAllEntities()
+	if err != nil {
+		return nil, err
+	}
+
+	byName := make(map[string]string)
+	for _, entity := range all {
+		byName[entity.Name] = entity.ID
+	}
+
+	var ids []string
+	for _, entity := range entities {
+		if entity.ID != "" {
+			ids = append(ids, entity.ID)
+		} else if id, ok := byName[entity.Name]; ok {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
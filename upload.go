@@ -0,0 +1,323 @@
+package dialogflow
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"unicode"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+const (
+	defaultChunkEntries = 1000
+	defaultChunkBytes   = 512 * 1024
+)
+
+// errUploadAborted stops the chunk producer once an upload has failed
+var errUploadAborted = errors.New("upload aborted")
+
+// EntryUploader uploads a large number of entries to an entity in size-bounded chunks
+//
+// Chunks are formed deterministically from the input, so an upload that failed can be
+// resumed by setting Offset to the Completed count of the returned UploadError and
+// uploading the same input again
+type EntryUploader struct {
+	Client   *Client
+	EntityID string
+
+	// Update sends chunks with UpdateEntityEntries instead of AddEntityEntries
+	Update bool
+
+	// MaxEntries and MaxBytes bound the number of entries and the encoded size of a chunk
+	// Zero values default to 1000 entries and 512KiB
+	MaxEntries int
+	MaxBytes   int
+
+	// Concurrency is the number of chunks uploaded at once, at least 1
+	Concurrency int
+
+	// Offset is the number of leading chunks to skip, as they were uploaded before
+	Offset int
+
+	// Progress, if set, is called after every uploaded chunk, one call at a time
+	Progress func(UploadProgress)
+}
+
+// UploadProgress reports the state of an upload after a chunk has been sent
+type UploadProgress struct {
+	// Chunk is the index of the chunk that was just uploaded
+	Chunk int
+	// Entries is the number of entries uploaded so far, including skipped chunks
+	Entries int
+	// Completed is the number of leading chunks that are all uploaded
+	Completed int
+}
+
+// UploadError reports the chunk that failed to upload
+type UploadError struct {
+	// Chunk is the index of the failed chunk, or -1 if reading the entries failed
+	Chunk int
+	// Completed is the number of leading chunks that are all uploaded
+	// Use it as the Offset to resume the upload
+	Completed int
+	Err       error
+}
+
+func (err *UploadError) Error() string {
+	if err.Chunk < 0 {
+		return fmt.Sprintf("reading entries failed, resume from offset %d: %v", err.Completed, err.Err)
+	}
+	return fmt.Sprintf("chunk %d failed, resume from offset %d: %v", err.Chunk, err.Completed, err.Err)
+}
+
+func (err *UploadError) Unwrap() error {
+	return err.Err
+}
+
+type entryChunk struct {
+	index   int
+	entries []model.Entry
+}
+
+// Upload uploads entries in chunks
+func (uploader *EntryUploader) Upload(entries []model.Entry) error {
+	return uploader.upload(func(fn func(model.Entry) error) error {
+		for _, entry := range entries {
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// UploadReader uploads entries decoded from r in chunks, without reading them all in memory
+// r holds either a JSON array of entries or one JSON entry per line
+func (uploader *EntryUploader) UploadReader(r io.Reader) error {
+	return uploader.upload(func(fn func(model.Entry) error) error {
+		return decodeEntries(r, fn)
+	})
+}
+
+func (uploader *EntryUploader) upload(source func(func(model.Entry) error) error) error {
+	if uploader.Client == nil || uploader.EntityID == "" {
+		return errors.New("client and entity id cannot be empty")
+	}
+
+	// Snapshot the entity once rather than before every chunk
+	// A resumed upload keeps the snapshot of its first attempt
+	client := uploader.Client
+	if client.GetSnapshotStore() != nil && !client.IsDryRun() && uploader.Offset == 0 {
+		if _, err := client.Snapshot(nil, []string{uploader.EntityID}); err != nil {
+			return &UploadError{Chunk: -1, Err: fmt.Errorf("could not snapshot entity: %v", err)}
+		}
+	}
+
+	concurrency := uploader.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	chunks := make(chan entryChunk)
+	abort := make(chan struct{})
+	var abortOnce sync.Once
+
+	var (
+		mu       sync.Mutex
+		done     = make(map[int]bool)
+		uploaded int
+		failure  *UploadError
+	)
+
+	completed := func() int {
+		n := uploader.Offset
+		for done[n] {
+			n++
+		}
+		return n
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chunk := range chunks {
+				err := uploader.send(chunk.entries)
+
+				mu.Lock()
+				if err != nil {
+					if failure == nil || chunk.index < failure.Chunk {
+						failure = &UploadError{Chunk: chunk.index, Err: err}
+					}
+					mu.Unlock()
+					abortOnce.Do(func() { close(abort) })
+					continue
+				}
+
+				done[chunk.index] = true
+				uploaded += len(chunk.entries)
+				progress := UploadProgress{Chunk: chunk.index, Entries: uploaded, Completed: completed()}
+				if uploader.Progress != nil {
+					uploader.Progress(progress)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	err := uploader.split(source, func(chunk entryChunk) error {
+		if chunk.index < uploader.Offset {
+			mu.Lock()
+			uploaded += len(chunk.entries)
+			mu.Unlock()
+			return nil
+		}
+
+		select {
+		case chunks <- chunk:
+			return nil
+		case <-abort:
+			return errUploadAborted
+		}
+	})
+	close(chunks)
+	wg.Wait()
+
+	if failure != nil {
+		failure.Completed = completed()
+		return failure
+	}
+
+	if err != nil {
+		return &UploadError{Chunk: -1, Completed: completed(), Err: err}
+	}
+
+	return nil
+}
+
+// split groups the entries produced by source into chunks
+func (uploader *EntryUploader) split(source func(func(model.Entry) error) error, emit func(entryChunk) error) error {
+	maxEntries, maxBytes := uploader.MaxEntries, uploader.MaxBytes
+	if maxEntries <= 0 {
+		maxEntries = defaultChunkEntries
+	}
+	if maxBytes <= 0 {
+		maxBytes = defaultChunkBytes
+	}
+
+	chunk := entryChunk{}
+	size := 2
+
+	err := source(func(entry model.Entry) error {
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+
+		if len(chunk.entries) > 0 && (len(chunk.entries) >= maxEntries || size+len(encoded)+1 > maxBytes) {
+			if err := emit(chunk); err != nil {
+				return err
+			}
+			chunk = entryChunk{index: chunk.index + 1}
+			size = 2
+		}
+
+		chunk.entries = append(chunk.entries, entry)
+		size += len(encoded) + 1
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(chunk.entries) > 0 {
+		return emit(chunk)
+	}
+	return nil
+}
+
+func (uploader *EntryUploader) send(entries []model.Entry) error {
+	var response model.QueryResponse
+	var err error
+
+	// The entity was snapshotted once before the upload
+	if uploader.Update {
+		response, err = uploader.Client.sendEntityEntries("UpdateEntityEntries", http.MethodPut, uploader.EntityID, entries, true)
+	} else {
+		response, err = uploader.Client.sendEntityEntries("AddEntityEntries", http.MethodPost, uploader.EntityID, entries, true)
+	}
+	if err != nil {
+		return err
+	}
+
+	return statusError(response.Status)
+}
+
+// decodeEntries calls fn for each entry of a JSON array or of a stream of JSON lines
+func decodeEntries(r io.Reader, fn func(model.Entry) error) error {
+	reader := bufio.NewReader(r)
+
+	first, err := peekNonSpace(reader)
+	if err == io.EOF {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(reader)
+	if first == '[' {
+		if _, err := decoder.Token(); err != nil {
+			return err
+		}
+	}
+
+	for line := 1; ; line++ {
+		if first == '[' && !decoder.More() {
+			_, err := decoder.Token()
+			return err
+		}
+
+		var entry model.Entry
+		err := decoder.Decode(&entry)
+		if err == io.EOF && first != '[' {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("entry %d: %v", line, err)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+}
+
+// peekNonSpace skips leading white space and a byte order mark and returns the next byte
+// without consuming it
+func peekNonSpace(reader *bufio.Reader) (byte, error) {
+	for {
+		r, _, err := reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+		if r == '\uFEFF' || unicode.IsSpace(r) {
+			continue
+		}
+
+		if err := reader.UnreadRune(); err != nil {
+			return 0, err
+		}
+		b, err := reader.Peek(1)
+		if err != nil {
+			return 0, err
+		}
+		return b[0], nil
+	}
+}
@@ -0,0 +1,110 @@
+package dialogflow
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// entriesServer accepts entry uploads, failing the first upload of the chunk starting with failAt
+type entriesServer struct {
+	mu       sync.Mutex
+	failAt   string
+	failed   bool
+	received []string
+}
+
+func (server *entriesServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var entries []model.Entry
+	if err := json.NewDecoder(r.Body).Decode(&entries); err != nil || len(entries) == 0 {
+		http.Error(w, "bad entries", http.StatusBadRequest)
+		return
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+
+	if entries[0].Value == server.failAt && !server.failed {
+		server.failed = true
+		fmt.Fprint(w, `{"status": {"code": 400, "errorType": "bad_request", "errorDetails": "rejected"}}`)
+		return
+	}
+
+	for _, entry := range entries {
+		server.received = append(server.received, entry.Value)
+	}
+	fmt.Fprint(w, `{"status": {"code": 200, "errorType": "success"}}`)
+}
+
+// takeReceived returns the sorted values received so far and starts a new record
+func (server *entriesServer) takeReceived() []string {
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	received := server.received
+	server.received = nil
+	sort.Strings(received)
+	return received
+}
+
+func TestEntryUploaderResume(t *testing.T) {
+	var entries []model.Entry
+	for i := 0; i < 10; i++ {
+		entries = append(entries, model.Entry{Value: fmt.Sprintf("e%d", i)})
+	}
+
+	// Chunks of 2 entries, the third of which fails once
+	server := &entriesServer{failAt: "e4"}
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	client := NewClient("token")
+	client.apiBaseURL = srv.URL + "/"
+
+	var progress []UploadProgress
+	uploader := &EntryUploader{
+		Client:      client,
+		EntityID:    "city",
+		MaxEntries:  2,
+		Concurrency: 3,
+		Progress:    func(p UploadProgress) { progress = append(progress, p) },
+	}
+
+	err := uploader.Upload(entries)
+	var uploadErr *UploadError
+	if !errors.As(err, &uploadErr) {
+		t.Fatalf("got %v, want an UploadError", err)
+	}
+	if uploadErr.Chunk != 2 || uploadErr.Completed != 2 {
+		t.Errorf("got chunk %d completed %d, want chunk 2 completed 2", uploadErr.Chunk, uploadErr.Completed)
+	}
+
+	// Chunks after the failed one may have been uploaded concurrently, the first two must have been
+	first := server.takeReceived()
+	if len(first) < 4 || !reflect.DeepEqual(first[:4], []string{"e0", "e1", "e2", "e3"}) {
+		t.Errorf("first attempt uploaded %q", first)
+	}
+
+	progress = nil
+	uploader.Offset = uploadErr.Completed
+	if err := uploader.Upload(entries); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := server.takeReceived(), []string{"e4", "e5", "e6", "e7", "e8", "e9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("resumed upload sent %q, want %q", got, want)
+	}
+	if len(progress) != 3 {
+		t.Fatalf("got %d progress reports, want 3", len(progress))
+	}
+	if last := progress[len(progress)-1]; last.Entries != len(entries) || last.Completed != 5 {
+		t.Errorf("got final progress %+v, want all entries and 5 completed chunks", last)
+	}
+}
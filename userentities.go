@@ -0,0 +1,289 @@
+package dialogflow
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// UserEntityMode controls how pushed user entities relate to the agent's entity of the same name
+type UserEntityMode int
+
+const (
+	// ReplaceEntries makes a user entity replace the entries of the agent's entity for the session,
+	// and a later push of the same name replaces the earlier one
+	ReplaceEntries UserEntityMode = iota
+	// MergeEntries extends the agent's entity with the user entity's entries for the session,
+	// and a later push of the same name adds to the entries pushed before
+	MergeEntries
+)
+
+// UserEntityManager tracks the user entities pushed for each session so they can be
+// re-pushed when a session is recreated and removed once they expire
+type UserEntityManager struct {
+	client *Client
+	ttl    time.Duration
+	mode   UserEntityMode
+
+	// mu guards sessions and is not held during API calls
+	mu       sync.Mutex
+	sessions map[string]map[string]trackedUserEntity
+}
+
+type trackedUserEntity struct {
+	entity   model.UserEntity
+	pushedAt time.Time
+}
+
+// NewUserEntityManager creates a manager pushing user entities through client
+// Entities expire ttl after they were last pushed, a ttl of 0 keeps them forever
+func NewUserEntityManager(client *Client, ttl time.Duration, mode UserEntityMode) *UserEntityManager {
+	return &UserEntityManager{
+		client:   client,
+		ttl:      ttl,
+		mode:     mode,
+		sessions: make(map[string]map[string]trackedUserEntity),
+	}
+}
+
+// Push sends entities for session and starts tracking them
+func (manager *UserEntityManager) Push(session string, entities ...model.UserEntity) error {
+	if session == "" || len(entities) == 0 {
+		return errors.New("session and entities cannot be empty")
+	}
+
+	manager.mu.Lock()
+	tracked := manager.sessions[session]
+	pushed := make([]model.UserEntity, len(entities))
+	for i, entity := range entities {
+		if entity.Name == "" {
+			manager.mu.Unlock()
+			return errors.New("user entity name cannot be empty")
+		}
+
+		entity.SessionID = session
+		entity.Extend = manager.mode == MergeEntries
+		if previous, ok := tracked[entity.Name]; ok && manager.mode == MergeEntries {
+			entity.Entries = mergeEntries(previous.entity.Entries, entity.Entries)
+		}
+		pushed[i] = entity
+	}
+	manager.mu.Unlock()
+
+	if err := manager.send(session, pushed); err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	tracked = manager.sessions[session]
+	if tracked == nil {
+		tracked = make(map[string]trackedUserEntity)
+		manager.sessions[session] = tracked
+	}
+
+	now := time.Now()
+	for _, entity := range pushed {
+		// A concurrent push of the same name extended the entity too
+		if previous, ok := tracked[entity.Name]; ok && manager.mode == MergeEntries {
+			entity.Entries = mergeEntries(previous.entity.Entries, entity.Entries)
+		}
+		tracked[entity.Name] = trackedUserEntity{entity: entity, pushedAt: now}
+	}
+
+	return nil
+}
+
+// Refresh re-pushes the unexpired user entities of session, for example after the
+// session was recreated and lost them
+// It does not extend their lifetime
+func (manager *UserEntityManager) Refresh(session string) error {
+	manager.mu.Lock()
+	var entities []model.UserEntity
+	for _, tracked := range manager.sessions[session] {
+		if !manager.expired(tracked, time.Now()) {
+			entities = append(entities, tracked.entity)
+		}
+	}
+	manager.mu.Unlock()
+
+	if len(entities) == 0 {
+		return nil
+	}
+
+	sort.Slice(entities, func(i, j int) bool {
+		return entities[i].Name < entities[j].Name
+	})
+
+	return manager.send(session, entities)
+}
+
+// Get returns the tracked user entity with name name for session
+func (manager *UserEntityManager) Get(session, name string) (model.UserEntity, bool) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	tracked, ok := manager.sessions[session][name]
+	if !ok || manager.expired(tracked, time.Now()) {
+		return model.UserEntity{}, false
+	}
+	return tracked.entity, true
+}
+
+// Remove deletes the user entity with name name from session and stops tracking it
+func (manager *UserEntityManager) Remove(session, name string) error {
+	manager.mu.Lock()
+	tracked := manager.sessions[session][name]
+	manager.mu.Unlock()
+
+	if err := manager.remove(session, name); err != nil {
+		return err
+	}
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.untrack(session, name, tracked.pushedAt)
+	return nil
+}
+
+// Expire deletes every user entity whose lifetime has ended and returns how many were removed
+// Entities that could not be deleted remain tracked so a later call retries them
+func (manager *UserEntityManager) Expire() (int, error) {
+	type expiredEntity struct {
+		session, name string
+		pushedAt      time.Time
+	}
+
+	manager.mu.Lock()
+	now := time.Now()
+	var expired []expiredEntity
+	for session, entities := range manager.sessions {
+		for name, tracked := range entities {
+			if manager.expired(tracked, now) {
+				expired = append(expired, expiredEntity{session, name, tracked.pushedAt})
+			}
+		}
+	}
+	manager.mu.Unlock()
+
+	removed := 0
+	var firstErr error
+
+	for _, entity := range expired {
+		if err := manager.remove(entity.session, entity.name); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+
+		manager.mu.Lock()
+		manager.untrack(entity.session, entity.name, entity.pushedAt)
+		manager.mu.Unlock()
+		removed++
+	}
+
+	return removed, firstErr
+}
+
+// Run calls Expire every interval until ctx is done
+func (manager *UserEntityManager) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			manager.Expire()
+		}
+	}
+}
+
+// Sessions returns the sessions that have tracked user entities
+func (manager *UserEntityManager) Sessions() []string {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	sessions := make([]string, 0, len(manager.sessions))
+	for session := range manager.sessions {
+		sessions = append(sessions, session)
+	}
+	sort.Strings(sessions)
+
+	return sessions
+}
+
+func (manager *UserEntityManager) send(session string, entities []model.UserEntity) error {
+	response, err := manager.client.CreateUserEntities(session, entities)
+	if err != nil {
+		return err
+	}
+
+	return statusError(response.Status)
+}
+
+func (manager *UserEntityManager) remove(session, name string) error {
+	response, err := manager.client.DeleteUserEntity(session, name)
+	if err != nil {
+		return err
+	}
+
+	return statusError(response.Status)
+}
+
+// untrack stops tracking a user entity removed from the API
+// The entity stays tracked if it was pushed again after pushedAt while the lock was released
+func (manager *UserEntityManager) untrack(session, name string, pushedAt time.Time) {
+	if tracked, ok := manager.sessions[session][name]; ok && tracked.pushedAt.After(pushedAt) {
+		return
+	}
+
+	delete(manager.sessions[session], name)
+	if len(manager.sessions[session]) == 0 {
+		delete(manager.sessions, session)
+	}
+}
+
+func (manager *UserEntityManager) expired(tracked trackedUserEntity, now time.Time) bool {
+	return manager.ttl > 0 && now.Sub(tracked.pushedAt) >= manager.ttl
+}
+
+// mergeEntries adds the entries of extra to base, merging the synonyms of entries with the same value
+func mergeEntries(base, extra []model.Entry) []model.Entry {
+	merged := make([]model.Entry, 0, len(base)+len(extra))
+	positions := make(map[string]int)
+
+	for _, entry := range append(append([]model.Entry(nil), base...), extra...) {
+		i, ok := positions[entry.Value]
+		if !ok {
+			positions[entry.Value] = len(merged)
+			merged = append(merged, model.Entry{Value: entry.Value, Synonyms: append([]string(nil), entry.Synonyms...)})
+			continue
+		}
+
+		for _, synonym := range entry.Synonyms {
+			if !containsString(merged[i].Synonyms, synonym) {
+				merged[i].Synonyms = append(merged[i].Synonyms, synonym)
+			}
+		}
+	}
+
+	return merged
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package webhook
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrUnauthorized is reported for requests with missing or wrong credentials
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrForbidden is reported for requests from addresses outside the allowlist
+	ErrForbidden = errors.New("forbidden")
+)
+
+// AuthConfig configures the Authenticate middleware
+// Every configured check must pass
+type AuthConfig struct {
+	// Username and Password enable basic auth, as configured in the fulfillment settings
+	Username string
+	Password string
+	// Headers are headers that must carry the given values, e.g. a shared token
+	Headers map[string]string
+	// AllowedNetworks are the IP addresses and CIDR ranges allowed to call the webhook
+	// Any address is allowed if empty
+	AllowedNetworks []string
+	// TrustedProxies are the IP addresses and CIDR ranges of the proxies in front of the webhook
+	// For requests coming from one of them the client address is taken from X-Forwarded-For,
+	// read from the right and skipping the addresses of trusted proxies
+	TrustedProxies []string
+	// RejectCode replaces the status of rejections,
+	// 401 for bad credentials and 403 for addresses outside the allowlist by default
+	RejectCode int
+	// RejectMessage replaces the error details of rejections
+	RejectMessage string
+	// OnReject is called with every rejected request, e.g. for logging
+	OnReject func(r *http.Request, err error)
+}
+
+// Authenticate creates HTTP middleware that rejects webhook calls failing the checks of config
+// At least one check must be configured
+// Secrets are compared in constant time
+func Authenticate(config AuthConfig) (func(http.Handler) http.Handler, error) {
+	if config.Password != "" && config.Username == "" {
+		return nil, errors.New("password requires a username")
+	}
+	if config.Username != "" && config.Password == "" {
+		return nil, errors.New("username requires a password")
+	}
+	for name, value := range config.Headers {
+		if value == "" {
+			return nil, fmt.Errorf("header %s requires a value", name)
+		}
+	}
+	// An empty config, e.g. from unset environment variables, must not let everyone through
+	if config.Username == "" && len(config.Headers) == 0 && len(config.AllowedNetworks) == 0 {
+		return nil, errors.New("at least one of username, headers or allowed networks is required")
+	}
+
+	networks, err := parseNetworks(config.AllowedNetworks)
+	if err != nil {
+		return nil, err
+	}
+	proxies, err := parseNetworks(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxies: %v", err)
+	}
+
+	check := func(r *http.Request) error {
+		if len(networks) > 0 {
+			ip := clientIP(r, proxies)
+			if ip == nil || !containsIP(networks, ip) {
+				return fmt.Errorf("%w: address %s is not allowed", ErrForbidden, ip)
+			}
+		}
+
+		if config.Username != "" {
+			username, password, ok := r.BasicAuth()
+			// Both comparisons always run so that timing does not reveal which one failed
+			validUsername := secureCompare(username, config.Username)
+			validPassword := secureCompare(password, config.Password)
+			if !ok || !validUsername || !validPassword {
+				return fmt.Errorf("%w: invalid basic auth credentials", ErrUnauthorized)
+			}
+		}
+
+		for name, value := range config.Headers {
+			if !secureCompare(r.Header.Get(name), value) {
+				return fmt.Errorf("%w: invalid %s header", ErrUnauthorized, name)
+			}
+		}
+
+		return nil
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			err := check(r)
+			if err == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if config.OnReject != nil {
+				config.OnReject(r, err)
+			}
+
+			code := http.StatusUnauthorized
+			if errors.Is(err, ErrForbidden) {
+				code = http.StatusForbidden
+			} else if config.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="webhook"`)
+			}
+			if config.RejectCode != 0 {
+				code = config.RejectCode
+			}
+
+			message := http.StatusText(code)
+			if config.RejectMessage != "" {
+				message = config.RejectMessage
+			}
+			writeError(w, code, message)
+		})
+	}, nil
+}
+
+// secureCompare compares a and b in constant time, regardless of their lengths
+func secureCompare(a, b string) bool {
+	hashA, hashB := sha256.Sum256([]byte(a)), sha256.Sum256([]byte(b))
+	return subtle.ConstantTimeCompare(hashA[:], hashB[:]) == 1
+}
+
+// parseNetworks parses IP addresses and CIDR ranges
+func parseNetworks(addresses []string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, address := range addresses {
+		if !strings.Contains(address, "/") {
+			ip := net.ParseIP(address)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid IP address %q", address)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(address)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %v", address, err)
+		}
+		networks = append(networks, network)
+	}
+	return networks, nil
+}
+
+// clientIP returns the address of the caller, or nil if it cannot be parsed
+// X-Forwarded-For is only read when the request comes from a trusted proxy, and from the
+// right, since clients can put any address at its start
+func clientIP(r *http.Request, proxies []*net.IPNet) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !containsIP(proxies, ip) {
+		return ip
+	}
+
+	var forwarded []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		forwarded = append(forwarded, strings.Split(header, ",")...)
+	}
+
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		ip = net.ParseIP(strings.TrimSpace(forwarded[i]))
+		if ip == nil || !containsIP(proxies, ip) {
+			return ip
+		}
+	}
+
+	// Every hop is a trusted proxy
+	return ip
+}
+
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
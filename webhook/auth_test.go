@@ -0,0 +1,239 @@
+package webhook
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     AuthConfig
+		remoteAddr string
+		forwarded  []string
+		username   string
+		password   string
+		headers    map[string]string
+		want       int
+	}{
+		{
+			name:     "basic auth",
+			config:   AuthConfig{Username: "user", Password: "secret"},
+			username: "user",
+			password: "secret",
+			want:     http.StatusOK,
+		},
+		{
+			name:     "wrong password",
+			config:   AuthConfig{Username: "user", Password: "secret"},
+			username: "user",
+			password: "guess",
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:     "wrong username",
+			config:   AuthConfig{Username: "user", Password: "secret"},
+			username: "admin",
+			password: "secret",
+			want:     http.StatusUnauthorized,
+		},
+		{
+			name:   "missing basic auth",
+			config: AuthConfig{Username: "user", Password: "secret"},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:    "header",
+			config:  AuthConfig{Headers: map[string]string{"X-Token": "abc"}},
+			headers: map[string]string{"X-Token": "abc"},
+			want:    http.StatusOK,
+		},
+		{
+			name:    "wrong header",
+			config:  AuthConfig{Headers: map[string]string{"X-Token": "abc"}},
+			headers: map[string]string{"X-Token": "abd"},
+			want:    http.StatusUnauthorized,
+		},
+		{
+			name:   "missing header",
+			config: AuthConfig{Headers: map[string]string{"X-Token": "abc"}},
+			want:   http.StatusUnauthorized,
+		},
+		{
+			name:       "allowed address",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}},
+			remoteAddr: "10.1.2.3:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "allowed single address",
+			config:     AuthConfig{AllowedNetworks: []string{"192.0.2.7"}},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "allowed IPv6 address",
+			config:     AuthConfig{AllowedNetworks: []string{"2001:db8::/32"}},
+			remoteAddr: "[2001:db8::1]:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name:       "address outside the allowlist",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "forwarded for without trusted proxies",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}},
+			remoteAddr: "192.0.2.7:4000",
+			forwarded:  []string{"10.1.2.3"},
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "forwarded for from an untrusted address",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.1"}},
+			remoteAddr: "192.0.2.7:4000",
+			forwarded:  []string{"10.1.2.3"},
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "forwarded for from a trusted proxy",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}},
+			remoteAddr: "172.16.0.1:4000",
+			forwarded:  []string{"10.1.2.3"},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "spoofed first forwarded for entry",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}},
+			remoteAddr: "172.16.0.1:4000",
+			forwarded:  []string{"10.1.2.3, 192.0.2.7"},
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "chain of trusted proxies",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}},
+			remoteAddr: "172.16.0.1:4000",
+			forwarded:  []string{"192.0.2.7, 10.1.2.3", "172.16.5.5"},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "invalid forwarded for entry",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}, TrustedProxies: []string{"172.16.0.0/12"}},
+			remoteAddr: "172.16.0.1:4000",
+			forwarded:  []string{"10.1.2.3, unknown"},
+			want:       http.StatusForbidden,
+		},
+		{
+			name:       "trusted proxy without forwarded for",
+			config:     AuthConfig{AllowedNetworks: []string{"172.16.0.0/12"}, TrustedProxies: []string{"172.16.0.0/12"}},
+			remoteAddr: "172.16.0.1:4000",
+			want:       http.StatusOK,
+		},
+		{
+			name: "every check passes",
+			config: AuthConfig{
+				Username:        "user",
+				Password:        "secret",
+				Headers:         map[string]string{"X-Token": "abc"},
+				AllowedNetworks: []string{"10.0.0.0/8"},
+			},
+			remoteAddr: "10.1.2.3:4000",
+			username:   "user",
+			password:   "secret",
+			headers:    map[string]string{"X-Token": "abc"},
+			want:       http.StatusOK,
+		},
+		{
+			name:       "reject code",
+			config:     AuthConfig{AllowedNetworks: []string{"10.0.0.0/8"}, RejectCode: http.StatusNotFound},
+			remoteAddr: "192.0.2.7:4000",
+			want:       http.StatusNotFound,
+		},
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			middleware, err := Authenticate(test.config)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodPost, "/", nil)
+			if test.remoteAddr != "" {
+				r.RemoteAddr = test.remoteAddr
+			}
+			for _, forwarded := range test.forwarded {
+				r.Header.Add("X-Forwarded-For", forwarded)
+			}
+			if test.username != "" {
+				r.SetBasicAuth(test.username, test.password)
+			}
+			for name, value := range test.headers {
+				r.Header.Set(name, value)
+			}
+
+			w := httptest.NewRecorder()
+			middleware(ok).ServeHTTP(w, r)
+
+			if w.Code != test.want {
+				t.Errorf("got status %d, want %d", w.Code, test.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticateOnReject(t *testing.T) {
+	var rejected error
+	middleware, err := Authenticate(AuthConfig{
+		Username:      "user",
+		Password:      "secret",
+		RejectMessage: "go away",
+		OnReject: func(r *http.Request, err error) {
+			rejected = err
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	middleware(http.NotFoundHandler()).ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if !errors.Is(rejected, ErrUnauthorized) {
+		t.Errorf("got rejection %v, want ErrUnauthorized", rejected)
+	}
+	if w.Header().Get("WWW-Authenticate") == "" {
+		t.Error("missing WWW-Authenticate header")
+	}
+	if body := w.Body.String(); !strings.Contains(body, "go away") {
+		t.Errorf("body %s does not carry the reject message", body)
+	}
+}
+
+func TestAuthenticateConfigErrors(t *testing.T) {
+	configs := []AuthConfig{
+		{},
+		{TrustedProxies: []string{"10.0.0.0/8"}, RejectCode: http.StatusNotFound},
+		{Password: "secret"},
+		{Username: "user"},
+		{Headers: map[string]string{"X-Token": ""}},
+		{AllowedNetworks: []string{"10.0.0.0/33"}},
+		{AllowedNetworks: []string{"localhost"}},
+		{Username: "user", TrustedProxies: []string{"not an address"}},
+	}
+
+	for _, config := range configs {
+		if _, err := Authenticate(config); err == nil {
+			t.Errorf("%+v: got no error", config)
+		}
+	}
+}
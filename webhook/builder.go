@@ -0,0 +1,271 @@
+package webhook
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// Platforms of rich messages
+const (
+	PlatformFacebook = "facebook"
+	PlatformSlack    = "slack"
+	PlatformTelegram = "telegram"
+	PlatformKik      = "kik"
+	PlatformSkype    = "skype"
+	PlatformLine     = "line"
+	PlatformViber    = "viber"
+	PlatformGoogle   = "google"
+)
+
+// Facebook Messenger limits
+const (
+	facebookMaxQuickReplies    = 11
+	facebookMaxQuickReplyTitle = 20
+	facebookMaxCardButtons     = 3
+)
+
+// ValidationError lists the problems found in a built response
+type ValidationError struct {
+	Problems []string
+}
+
+func (err *ValidationError) Error() string {
+	return "invalid response: " + strings.Join(err.Problems, "; ")
+}
+
+// Card is a rich card message
+type Card struct {
+	Title    string
+	Subtitle string
+	ImageURL string
+	Buttons  []model.Button
+}
+
+// Builder composes webhook responses
+//
+//	webhook.NewBuilder().
+//		Text("Your table is booked").
+//		Platform(webhook.PlatformFacebook).QuickReplies("Anything else?", "Menu", "Directions").
+//		Context("booking", 5, map[string]interface{}{"id": id})
+//
+// Builders are Responders, so they can be returned from an ActionFunc as they are
+type Builder struct {
+	response Response
+	platform string
+	problems []string
+	// mayBeEmpty accepts a response without content, which leaves the reply to DialogFlow
+	mayBeEmpty bool
+}
+
+// NewBuilder creates an empty response builder
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (builder *Builder) problem(format string, args ...interface{}) {
+	builder.problems = append(builder.problems, fmt.Sprintf(format, args...))
+}
+
+func (builder *Builder) message(message model.Message) *Builder {
+	message.Platform = builder.platform
+	builder.response.Messages = append(builder.response.Messages, message)
+	return builder
+}
+
+// Platform makes the following messages target platform, or every platform if empty
+func (builder *Builder) Platform(platform string) *Builder {
+	builder.platform = platform
+	return builder
+}
+
+// Text adds a text message
+// The first text for every platform also becomes the response's speech and display text
+func (builder *Builder) Text(text string) *Builder {
+	if builder.platform == "" && builder.response.Speech == "" {
+		builder.response.Speech = text
+		builder.response.DisplayText = text
+	}
+	return builder.message(model.Message{Type: model.TextMessage, Speech: text})
+}
+
+// SSML sets the spoken response to ssml, with displayText shown on screens
+// A missing <speak> root element is added
+func (builder *Builder) SSML(ssml, displayText string) *Builder {
+	if !strings.HasPrefix(strings.TrimSpace(ssml), "<speak>") {
+		ssml = "<speak>" + ssml + "</speak>"
+	}
+	builder.response.Speech = ssml
+	builder.response.DisplayText = displayText
+	return builder
+}
+
+// Card adds a card message
+func (builder *Builder) Card(card Card) *Builder {
+	if card.Title == "" {
+		builder.problem("card is missing a title")
+	}
+	if card.ImageURL != "" {
+		builder.checkURL("card image", card.ImageURL)
+	}
+	for _, button := range card.Buttons {
+		if button.Text == "" {
+			builder.problem("card %q has a button without text", card.Title)
+		}
+	}
+	if builder.platform == PlatformFacebook && len(card.Buttons) > facebookMaxCardButtons {
+		builder.problem("facebook cards have at most %d buttons, card %q has %d", facebookMaxCardButtons, card.Title, len(card.Buttons))
+	}
+
+	return builder.message(model.Message{
+		Type:     model.CardMessage,
+		Title:    card.Title,
+		Subtitle: card.Subtitle,
+		ImageURL: card.ImageURL,
+		Buttons:  card.Buttons,
+	})
+}
+
+// QuickReplies adds suggested replies, shown under title
+func (builder *Builder) QuickReplies(title string, replies ...string) *Builder {
+	if len(replies) == 0 {
+		builder.problem("quick replies cannot be empty")
+	}
+	if builder.platform == PlatformFacebook {
+		if len(replies) > facebookMaxQuickReplies {
+			builder.problem("facebook allows at most %d quick replies, got %d", facebookMaxQuickReplies, len(replies))
+		}
+		for _, reply := range replies {
+			if utf8.RuneCountInString(reply) > facebookMaxQuickReplyTitle {
+				builder.problem("facebook quick reply %q is longer than %d characters", reply, facebookMaxQuickReplyTitle)
+			}
+		}
+	}
+
+	return builder.message(model.Message{Type: model.QuickRepliesMessage, Title: title, Replies: replies})
+}
+
+// Image adds an image message
+func (builder *Builder) Image(imageURL string) *Builder {
+	builder.checkURL("image", imageURL)
+	return builder.message(model.Message{Type: model.ImageMessage, ImageURL: imageURL})
+}
+
+// Payload adds a custom payload message, passed to the platform as it is
+func (builder *Builder) Payload(payload map[string]interface{}) *Builder {
+	if len(payload) == 0 {
+		builder.problem("payload cannot be empty")
+	}
+	return builder.message(model.Message{Type: model.PayloadMessage, Payload: payload})
+}
+
+func (builder *Builder) checkURL(what, rawURL string) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Host == "" || parsed.Scheme != "http" && parsed.Scheme != "https" {
+		builder.problem("%s URL %q is not an absolute http(s) URL", what, rawURL)
+	}
+}
+
+// Data sets a field of the response's data, which is passed to the integration
+func (builder *Builder) Data(key string, value interface{}) *Builder {
+	if builder.response.Data == nil {
+		builder.response.Data = make(map[string]interface{})
+	}
+	builder.response.Data[key] = value
+	return builder
+}
+
+// Context sets an output context, replacing any earlier one with the same name
+// A lifespan of 0 removes the context
+func (builder *Builder) Context(name string, lifespan int, parameters map[string]interface{}) *Builder {
+	if name == "" || strings.ContainsAny(name, " \t") {
+		builder.problem("context name %q must be a non-empty word", name)
+	}
+	if lifespan < 0 {
+		builder.problem("context %q has a negative lifespan", name)
+	}
+
+	context := model.Context{Name: name, Lifespan: lifespan, Parameters: parameters}
+	for i, existing := range builder.response.ContextOut {
+		if strings.EqualFold(existing.Name, name) {
+			builder.response.ContextOut[i] = context
+			return builder
+		}
+	}
+	builder.response.ContextOut = append(builder.response.ContextOut, context)
+	return builder
+}
+
+// Followup triggers the event called name, with data as its parameters
+func (builder *Builder) Followup(name string, data map[string]string) *Builder {
+	if name == "" {
+		builder.problem("followup event name cannot be empty")
+	}
+	builder.response.FollowupEvent = &model.Event{Name: name, Data: data}
+	return builder
+}
+
+// EndConversation tells the integration to close the conversation after this response
+func (builder *Builder) EndConversation() *Builder {
+	builder.google().ExpectUserResponse = false
+	return builder
+}
+
+// Source sets the source of the response
+func (builder *Builder) Source(source string) *Builder {
+	builder.response.Source = source
+	return builder
+}
+
+// Validate reports the problems found while building, if any
+func (builder *Builder) Validate() error {
+	problems := append([]string(nil), builder.problems...)
+	problems = append(problems, builder.googleProblems()...)
+	response := builder.response
+	if !builder.mayBeEmpty && response.Speech == "" && len(response.Messages) == 0 && len(response.ContextOut) == 0 && response.FollowupEvent == nil && response.Data == nil {
+		problems = append(problems, "response is empty")
+	}
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// WebhookResponse validates and returns the built response
+func (builder *Builder) WebhookResponse() (*Response, error) {
+	if err := builder.Validate(); err != nil {
+		return nil, err
+	}
+	return builder.finish(), nil
+}
+
+// finish returns a copy of the built response ready to be encoded
+func (builder *Builder) finish() *Response {
+	response := builder.response
+	if google, ok := response.Data[PlatformGoogle].(*GooglePayload); ok {
+		response.Data = make(map[string]interface{}, len(builder.response.Data))
+		for key, value := range builder.response.Data {
+			response.Data[key] = value
+		}
+		response.Data[PlatformGoogle] = finishGoogle(google, response.Speech, response.DisplayText)
+	}
+	return &response
+}
+
+// Fulfillment validates and returns the built response as the fulfillment of a query response
+func (builder *Builder) Fulfillment() (model.Fulfillment, error) {
+	if err := builder.Validate(); err != nil {
+		return model.Fulfillment{}, err
+	}
+
+	response := builder.finish()
+	fulfillment := model.Fulfillment{Speech: response.Speech, Messages: response.Messages}
+	if response.Data != nil {
+		fulfillment.Data = []interface{}{response.Data}
+	}
+	return fulfillment, nil
+}
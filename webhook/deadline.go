@@ -0,0 +1,195 @@
+package webhook
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// DefaultBudget leaves a safety margin below DialogFlow's 5 second webhook timeout
+const DefaultBudget = 4 * time.Second
+
+// DeadlineConfig configures the Deadline middleware
+type DeadlineConfig struct {
+	// Budget is how long a handler may run, DefaultBudget if zero
+	Budget time.Duration
+	// Fallback is returned when a handler runs out of budget
+	// If nil the request fails, and DialogFlow falls back to the intent's own responses
+	Fallback *Response
+	// FollowupEvent, if set, is triggered instead of returning Fallback while the handler
+	// keeps running in the background
+	// When the event brings the session back to the webhook, the handler's result is returned
+	// Requests are recognized as the followup by their resolved query, which holds the event name
+	FollowupEvent string
+	// MaxFollowups caps the followup events triggered for a single request, 2 if zero
+	// Fallback is returned once they are used up
+	MaxFollowups int
+	// Timeout caps how long handlers keep running in the background, 30 seconds if zero
+	Timeout time.Duration
+}
+
+type result struct {
+	response *Response
+	err      error
+}
+
+// pendingResult is a handler still running, or done, after its request ran out of budget
+type pendingResult struct {
+	done      chan struct{}
+	result    result
+	followups int
+}
+
+type deadline struct {
+	config DeadlineConfig
+	next   Handler
+
+	mu      sync.Mutex
+	pending map[string]*pendingResult
+}
+
+// Deadline creates middleware that stops waiting for handlers after a budget
+//
+// By default the handler's context is cancelled and config.Fallback is returned
+// With config.FollowupEvent set, only requests triggered by that event collect the result
+// of the session's pending handler, other requests of the session are handled afresh
+func Deadline(config DeadlineConfig) Middleware {
+	if config.Budget <= 0 {
+		config.Budget = DefaultBudget
+	}
+	if config.MaxFollowups <= 0 {
+		config.MaxFollowups = 2
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 30 * time.Second
+	}
+
+	return func(next Handler) Handler {
+		return &deadline{config: config, next: next, pending: make(map[string]*pendingResult)}
+	}
+}
+
+func (d *deadline) ServeWebhook(ctx context.Context, request *Request) (*Response, error) {
+	if d.config.FollowupEvent == "" || request.SessionID == "" {
+		return d.cancelling(ctx, request)
+	}
+
+	d.mu.Lock()
+	pending := d.pending[request.SessionID]
+	d.mu.Unlock()
+
+	// The user moved on, the pending result answers an earlier request
+	if pending != nil && !d.followup(request) {
+		d.forget(request.SessionID, pending)
+		pending = nil
+	}
+
+	if pending == nil {
+		pending = d.detach(ctx, request)
+	}
+
+	timer := time.NewTimer(d.config.Budget)
+	defer timer.Stop()
+
+	select {
+	case <-pending.done:
+		d.forget(request.SessionID, pending)
+		return pending.result.response, pending.result.err
+
+	case <-timer.C:
+		d.timedOut(request)
+
+		d.mu.Lock()
+		pending.followups++
+		exhausted := pending.followups > d.config.MaxFollowups
+		if exhausted {
+			delete(d.pending, request.SessionID)
+		} else {
+			d.pending[request.SessionID] = pending
+		}
+		d.mu.Unlock()
+
+		if exhausted {
+			return d.fallback()
+		}
+		return &Response{FollowupEvent: &model.Event{Name: d.config.FollowupEvent}}, nil
+
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// cancelling runs the handler with a context that is cancelled when the budget runs out
+func (d *deadline) cancelling(ctx context.Context, request *Request) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Budget)
+	defer cancel()
+
+	done := make(chan result, 1)
+	go func() {
+		response, err := d.next.ServeWebhook(ctx, request)
+		done <- result{response, err}
+	}()
+
+	select {
+	case result := <-done:
+		return result.response, result.err
+	case <-ctx.Done():
+		if ctx.Err() != context.DeadlineExceeded {
+			return nil, ctx.Err()
+		}
+		d.timedOut(request)
+		return d.fallback()
+	}
+}
+
+// detach runs the handler in the background, with a context that keeps the values of ctx
+// but outlives the request
+func (d *deadline) detach(ctx context.Context, request *Request) *pendingResult {
+	pending := &pendingResult{done: make(chan struct{})}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), d.config.Timeout)
+		defer cancel()
+
+		pending.result.response, pending.result.err = d.next.ServeWebhook(ctx, request)
+		close(pending.done)
+
+		// Drop results that are never collected
+		time.AfterFunc(d.config.Timeout, func() {
+			d.forget(request.SessionID, pending)
+		})
+	}()
+
+	return pending
+}
+
+// followup reports whether request was triggered by the followup event
+func (d *deadline) followup(request *Request) bool {
+	return strings.EqualFold(request.Result.ResolvedQuery, d.config.FollowupEvent)
+}
+
+// forget removes pending if it is still the session's pending result
+func (d *deadline) forget(sessionID string, pending *pendingResult) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.pending[sessionID] == pending {
+		delete(d.pending, sessionID)
+	}
+}
+
+func (d *deadline) timedOut(request *Request) {
+	log.Printf("webhook: action %q exceeded its %v budget", request.Result.Action, d.config.Budget)
+}
+
+func (d *deadline) fallback() (*Response, error) {
+	if d.config.Fallback == nil {
+		return nil, &Error{Code: http.StatusGatewayTimeout, Message: "fulfillment ran out of time"}
+	}
+	response := *d.config.Fallback
+	return &response, nil
+}
@@ -0,0 +1,172 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+type contextKey string
+
+// blockingHandler answers with its request's action once release is closed
+func blockingHandler(release <-chan struct{}, calls chan<- context.Context) Handler {
+	return HandlerFunc(func(ctx context.Context, request *Request) (*Response, error) {
+		if calls != nil {
+			calls <- ctx
+		}
+		select {
+		case <-release:
+			return &Response{Speech: request.Result.Action}, nil
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	})
+}
+
+func pendingCount(handler Handler) int {
+	d := handler.(*deadline)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.pending)
+}
+
+// waitFor polls condition until it holds or a second has passed
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	for start := time.Now(); !condition(); time.Sleep(time.Millisecond) {
+		if time.Since(start) > time.Second {
+			t.Fatal("condition not met within a second")
+		}
+	}
+}
+
+func TestDeadlineCancels(t *testing.T) {
+	calls := make(chan context.Context, 1)
+	fallback := &Response{Speech: "Still working on it"}
+	handler := Deadline(DeadlineConfig{Budget: 10 * time.Millisecond, Fallback: fallback})(blockingHandler(nil, calls))
+
+	response, err := handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1"})
+	if err != nil || response.Speech != fallback.Speech {
+		t.Errorf("got %+v, %v, want the fallback", response, err)
+	}
+	if response == fallback {
+		t.Errorf("got the configured fallback itself, want a copy")
+	}
+	if ctx := <-calls; ctx.Err() == nil {
+		t.Errorf("handler context was not cancelled")
+	}
+
+	handler = Deadline(DeadlineConfig{Budget: 10 * time.Millisecond})(blockingHandler(nil, nil))
+	_, err = handler.ServeWebhook(context.Background(), &Request{})
+	var webhookErr *Error
+	if !errors.As(err, &webhookErr) || webhookErr.Code != http.StatusGatewayTimeout {
+		t.Errorf("without a fallback got %v, want a 504 *Error", err)
+	}
+}
+
+func TestDeadlineFollowupEvent(t *testing.T) {
+	release := make(chan struct{})
+	calls := make(chan context.Context, 2)
+	handler := Deadline(DeadlineConfig{Budget: 10 * time.Millisecond, FollowupEvent: "still_working"})(blockingHandler(release, calls))
+
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), contextKey("user"), "ada"))
+	request := &Request{SessionID: "session-1", Result: model.Result{Action: "book", ResolvedQuery: "book a table"}}
+	response, err := handler.ServeWebhook(ctx, request)
+	cancel()
+	if err != nil || response.FollowupEvent == nil || response.FollowupEvent.Name != "still_working" {
+		t.Fatalf("got %+v, %v, want the followup event", response, err)
+	}
+
+	// The handler outlives its request and keeps the request's values
+	handlerCtx := <-calls
+	if handlerCtx.Err() != nil || handlerCtx.Value(contextKey("user")) != "ada" {
+		t.Errorf("got handler context error %v and user %v", handlerCtx.Err(), handlerCtx.Value(contextKey("user")))
+	}
+
+	close(release)
+	followup := &Request{SessionID: "session-1", Result: model.Result{Action: "book", ResolvedQuery: "STILL_WORKING"}}
+	response, err = handler.ServeWebhook(context.Background(), followup)
+	if err != nil || response.Speech != "book" {
+		t.Errorf("followup got %+v, %v, want the handler's result", response, err)
+	}
+	if n := pendingCount(handler); n != 0 {
+		t.Errorf("got %d pending results after collecting, want 0", n)
+	}
+	if len(calls) != 0 {
+		t.Errorf("followup ran the handler again")
+	}
+}
+
+func TestDeadlineNewRequestReplacesPending(t *testing.T) {
+	release := make(chan struct{})
+	handler := Deadline(DeadlineConfig{Budget: 10 * time.Millisecond, FollowupEvent: "still_working"})(blockingHandler(release, nil))
+
+	handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1", Result: model.Result{Action: "book"}})
+	close(release)
+
+	response, err := handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1", Result: model.Result{Action: "cancel"}})
+	if err != nil || response.Speech != "cancel" {
+		t.Errorf("got %+v, %v, want the new request handled afresh", response, err)
+	}
+}
+
+func TestDeadlineMaxFollowups(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	fallback := &Response{Speech: "Try again later"}
+	handler := Deadline(DeadlineConfig{
+		Budget:        10 * time.Millisecond,
+		Fallback:      fallback,
+		FollowupEvent: "still_working",
+		MaxFollowups:  2,
+	})(blockingHandler(release, nil))
+
+	requests := []*Request{
+		{SessionID: "session-1", Result: model.Result{ResolvedQuery: "book a table"}},
+		{SessionID: "session-1", Result: model.Result{ResolvedQuery: "still_working"}},
+		{SessionID: "session-1", Result: model.Result{ResolvedQuery: "still_working"}},
+	}
+	for i, request := range requests {
+		response, err := handler.ServeWebhook(context.Background(), request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if last := i == len(requests)-1; last != (response.Speech == fallback.Speech) || !last && response.FollowupEvent == nil {
+			t.Errorf("request %d: got %+v", i, response)
+		}
+	}
+	if n := pendingCount(handler); n != 0 {
+		t.Errorf("got %d pending results after the fallback, want 0", n)
+	}
+}
+
+func TestDeadlineForgetsAbandonedResults(t *testing.T) {
+	release := make(chan struct{})
+	handler := Deadline(DeadlineConfig{
+		Budget:        10 * time.Millisecond,
+		FollowupEvent: "still_working",
+		Timeout:       20 * time.Millisecond,
+	})(blockingHandler(release, nil))
+
+	handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1"})
+	if n := pendingCount(handler); n != 1 {
+		t.Fatalf("got %d pending results, want 1", n)
+	}
+
+	// The result is never collected and is dropped once Timeout passes
+	close(release)
+	waitFor(t, func() bool { return pendingCount(handler) == 0 })
+
+	// Handlers that never finish are cancelled by Timeout and dropped too
+	handler = Deadline(DeadlineConfig{
+		Budget:        10 * time.Millisecond,
+		FollowupEvent: "still_working",
+		Timeout:       20 * time.Millisecond,
+	})(blockingHandler(nil, nil))
+	handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1"})
+	waitFor(t, func() bool { return pendingCount(handler) == 0 })
+}
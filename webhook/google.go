@@ -0,0 +1,455 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ErrNotGoogle is returned when parsing the Google payload of a request that did not come
+// from Actions on Google
+var ErrNotGoogle = errors.New("request did not come from actions on google")
+
+// Surface capabilities
+const (
+	CapabilityScreen        = "actions.capability.SCREEN_OUTPUT"
+	CapabilityAudio         = "actions.capability.AUDIO_OUTPUT"
+	CapabilityMediaResponse = "actions.capability.MEDIA_RESPONSE_AUDIO"
+	CapabilityWebBrowser    = "actions.capability.WEB_BROWSER"
+)
+
+// Permissions that can be requested from the user
+const (
+	PermissionName            = "NAME"
+	PermissionPreciseLocation = "DEVICE_PRECISE_LOCATION"
+	PermissionCoarseLocation  = "DEVICE_COARSE_LOCATION"
+)
+
+// Sign-in statuses
+const (
+	SignInOK        = "OK"
+	SignInCancelled = "CANCELLED"
+	SignInError     = "ERROR"
+)
+
+// Actions on Google limits
+const (
+	googleMaxSuggestions     = 8
+	googleMaxSuggestionTitle = 25
+	googleMinOptions         = 2
+	googleMaxCarouselItems   = 10
+	googleMaxListItems       = 30
+)
+
+// GoogleRequest is the payload of requests from Actions on Google, found in the
+// original request's data
+type GoogleRequest struct {
+	IsInSandbox       bool               `json:"isInSandbox,omitempty"`
+	Surface           GoogleSurface      `json:"surface"`
+	AvailableSurfaces []GoogleSurface    `json:"availableSurfaces,omitempty"`
+	Inputs            []GoogleInput      `json:"inputs,omitempty"`
+	User              GoogleUser         `json:"user"`
+	Device            GoogleDevice       `json:"device"`
+	Conversation      GoogleConversation `json:"conversation"`
+}
+
+type GoogleSurface struct {
+	Capabilities []GoogleCapability `json:"capabilities,omitempty"`
+}
+
+type GoogleCapability struct {
+	Name string `json:"name"`
+}
+
+type GoogleInput struct {
+	Intent    string           `json:"intent,omitempty"`
+	RawInputs []GoogleRawInput `json:"rawInputs,omitempty"`
+	Arguments []GoogleArgument `json:"arguments,omitempty"`
+}
+
+type GoogleRawInput struct {
+	Query     string `json:"query,omitempty"`
+	InputType string `json:"inputType,omitempty"`
+}
+
+// GoogleArgument is a value the user gave in answer to a system intent
+type GoogleArgument struct {
+	Name      string          `json:"name"`
+	RawText   string          `json:"rawText,omitempty"`
+	TextValue string          `json:"textValue,omitempty"`
+	BoolValue bool            `json:"boolValue,omitempty"`
+	Extension json.RawMessage `json:"extension,omitempty"`
+}
+
+type GoogleUser struct {
+	UserID      string         `json:"userId,omitempty"`
+	Locale      string         `json:"locale,omitempty"`
+	LastSeen    string         `json:"lastSeen,omitempty"`
+	Permissions []string       `json:"permissions,omitempty"`
+	Profile     *GoogleProfile `json:"profile,omitempty"`
+	AccessToken string         `json:"accessToken,omitempty"`
+	UserStorage string         `json:"userStorage,omitempty"`
+}
+
+type GoogleProfile struct {
+	DisplayName string `json:"displayName,omitempty"`
+	GivenName   string `json:"givenName,omitempty"`
+	FamilyName  string `json:"familyName,omitempty"`
+}
+
+type GoogleDevice struct {
+	Location *GoogleLocation `json:"location,omitempty"`
+}
+
+type GoogleLocation struct {
+	Coordinates struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	} `json:"coordinates"`
+	FormattedAddress string `json:"formattedAddress,omitempty"`
+	City             string `json:"city,omitempty"`
+	ZipCode          string `json:"zipCode,omitempty"`
+}
+
+type GoogleConversation struct {
+	ConversationID    string `json:"conversationId,omitempty"`
+	Type              string `json:"type,omitempty"`
+	ConversationToken string `json:"conversationToken,omitempty"`
+}
+
+// Google parses the Actions on Google payload of request
+func (request *Request) Google() (*GoogleRequest, error) {
+	original := request.OriginalRequest
+	if original == nil || original.Source != PlatformGoogle || len(original.Data) == 0 {
+		return nil, ErrNotGoogle
+	}
+
+	var google GoogleRequest
+	if err := json.Unmarshal(original.Data, &google); err != nil {
+		return nil, fmt.Errorf("invalid google payload: %v", err)
+	}
+	return &google, nil
+}
+
+// HasCapability reports whether the surface of the conversation has the capability name
+func (google *GoogleRequest) HasCapability(name string) bool {
+	for _, capability := range google.Surface.Capabilities {
+		if capability.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Argument returns the argument called name of the request's inputs
+func (google *GoogleRequest) Argument(name string) (GoogleArgument, bool) {
+	for _, input := range google.Inputs {
+		for _, argument := range input.Arguments {
+			if argument.Name == name {
+				return argument, true
+			}
+		}
+	}
+	return GoogleArgument{}, false
+}
+
+// PermissionGranted reports whether the user granted the permissions asked with AskPermission
+func (google *GoogleRequest) PermissionGranted() bool {
+	argument, ok := google.Argument("PERMISSION")
+	return ok && (argument.BoolValue || argument.TextValue == "true")
+}
+
+// SignInStatus returns the outcome of a sign-in asked with SignIn, or "" if there is none
+func (google *GoogleRequest) SignInStatus() string {
+	argument, ok := google.Argument("SIGN_IN")
+	if !ok {
+		return ""
+	}
+
+	var extension struct {
+		Status string `json:"status"`
+	}
+	json.Unmarshal(argument.Extension, &extension)
+	return extension.Status
+}
+
+// SelectedOption returns the key of the carousel or list item the user selected, or ""
+func (google *GoogleRequest) SelectedOption() string {
+	argument, _ := google.Argument("OPTION")
+	return argument.TextValue
+}
+
+// GooglePayload is the Actions on Google part of a response's data
+type GooglePayload struct {
+	ExpectUserResponse bool                `json:"expectUserResponse"`
+	IsSSML             bool                `json:"isSsml,omitempty"`
+	NoInputPrompts     []GoogleSimple      `json:"noInputPrompts,omitempty"`
+	RichResponse       *GoogleRichResponse `json:"richResponse,omitempty"`
+	SystemIntent       *GoogleSystemIntent `json:"systemIntent,omitempty"`
+	UserStorage        string              `json:"userStorage,omitempty"`
+}
+
+type GoogleRichResponse struct {
+	Items             []GoogleItem       `json:"items,omitempty"`
+	Suggestions       []GoogleSuggestion `json:"suggestions,omitempty"`
+	LinkOutSuggestion *GoogleLinkOut     `json:"linkOutSuggestion,omitempty"`
+}
+
+// GoogleItem is a rich response item, with exactly one field set
+type GoogleItem struct {
+	SimpleResponse *GoogleSimple    `json:"simpleResponse,omitempty"`
+	BasicCard      *GoogleBasicCard `json:"basicCard,omitempty"`
+}
+
+// GoogleSimple is a spoken response, with text shown on screens
+type GoogleSimple struct {
+	TextToSpeech string `json:"textToSpeech,omitempty"`
+	SSML         string `json:"ssml,omitempty"`
+	DisplayText  string `json:"displayText,omitempty"`
+}
+
+type GoogleBasicCard struct {
+	Title         string         `json:"title,omitempty"`
+	Subtitle      string         `json:"subtitle,omitempty"`
+	FormattedText string         `json:"formattedText,omitempty"`
+	Image         *GoogleImage   `json:"image,omitempty"`
+	Buttons       []GoogleButton `json:"buttons,omitempty"`
+}
+
+type GoogleImage struct {
+	URL               string `json:"url"`
+	AccessibilityText string `json:"accessibilityText"`
+}
+
+type GoogleButton struct {
+	Title         string `json:"title"`
+	OpenURLAction struct {
+		URL string `json:"url"`
+	} `json:"openUrlAction"`
+}
+
+type GoogleSuggestion struct {
+	Title string `json:"title"`
+}
+
+type GoogleLinkOut struct {
+	DestinationName string `json:"destinationName"`
+	URL             string `json:"url"`
+}
+
+// GoogleSystemIntent asks Actions on Google to run a helper, e.g. a permission request
+type GoogleSystemIntent struct {
+	Intent string                 `json:"intent"`
+	Data   map[string]interface{} `json:"data,omitempty"`
+}
+
+// GoogleOption is an item of a carousel or list
+type GoogleOption struct {
+	// Key is returned by SelectedOption when the item is selected
+	Key         string
+	Synonyms    []string
+	Title       string
+	Description string
+	Image       *GoogleImage
+}
+
+func (option GoogleOption) item() map[string]interface{} {
+	info := map[string]interface{}{"key": option.Key}
+	if len(option.Synonyms) > 0 {
+		info["synonyms"] = option.Synonyms
+	}
+
+	item := map[string]interface{}{"optionInfo": info, "title": option.Title}
+	if option.Description != "" {
+		item["description"] = option.Description
+	}
+	if option.Image != nil {
+		item["image"] = option.Image
+	}
+	return item
+}
+
+// google returns the Actions on Google payload of the response, creating it if needed
+func (builder *Builder) google() *GooglePayload {
+	google, ok := builder.response.Data[PlatformGoogle].(*GooglePayload)
+	if !ok {
+		google = &GooglePayload{ExpectUserResponse: true}
+		builder.Data(PlatformGoogle, google)
+	}
+	return google
+}
+
+func (builder *Builder) richResponse() *GoogleRichResponse {
+	google := builder.google()
+	if google.RichResponse == nil {
+		google.RichResponse = &GoogleRichResponse{}
+	}
+	return google.RichResponse
+}
+
+// GoogleSimple adds a simple response to the Google rich response
+// speech may be SSML, and displayText may be empty to show the speech
+func (builder *Builder) GoogleSimple(speech, displayText string) *Builder {
+	simple := &GoogleSimple{TextToSpeech: speech, DisplayText: displayText}
+	if strings.HasPrefix(strings.TrimSpace(speech), "<speak>") {
+		simple.TextToSpeech, simple.SSML = "", speech
+	}
+
+	rich := builder.richResponse()
+	rich.Items = append(rich.Items, GoogleItem{SimpleResponse: simple})
+	return builder
+}
+
+// GoogleCard adds a basic card to the Google rich response
+func (builder *Builder) GoogleCard(card GoogleBasicCard) *Builder {
+	if card.FormattedText == "" && card.Image == nil {
+		builder.problem("google card %q needs formatted text or an image", card.Title)
+	}
+	if card.Image != nil {
+		builder.checkURL("google card image", card.Image.URL)
+	}
+	if len(card.Buttons) > 1 {
+		builder.problem("google card %q has %d buttons, at most 1 is allowed", card.Title, len(card.Buttons))
+	}
+
+	rich := builder.richResponse()
+	rich.Items = append(rich.Items, GoogleItem{BasicCard: &card})
+	return builder
+}
+
+// GoogleSuggestions adds suggestion chips to the Google rich response
+func (builder *Builder) GoogleSuggestions(titles ...string) *Builder {
+	rich := builder.richResponse()
+	for _, title := range titles {
+		if utf8.RuneCountInString(title) > googleMaxSuggestionTitle {
+			builder.problem("google suggestion %q is longer than %d characters", title, googleMaxSuggestionTitle)
+		}
+		rich.Suggestions = append(rich.Suggestions, GoogleSuggestion{Title: title})
+	}
+	if len(rich.Suggestions) > googleMaxSuggestions {
+		builder.problem("google allows at most %d suggestions, got %d", googleMaxSuggestions, len(rich.Suggestions))
+	}
+	return builder
+}
+
+// GoogleLinkOut adds a suggestion that opens url
+func (builder *Builder) GoogleLinkOut(name, url string) *Builder {
+	builder.checkURL("google link out", url)
+	builder.richResponse().LinkOutSuggestion = &GoogleLinkOut{DestinationName: name, URL: url}
+	return builder
+}
+
+func (builder *Builder) systemIntent(intent string, data map[string]interface{}) *Builder {
+	google := builder.google()
+	if google.SystemIntent != nil {
+		builder.problem("google responses have at most one system intent, %s is already set", google.SystemIntent.Intent)
+	}
+	google.SystemIntent = &GoogleSystemIntent{Intent: intent, Data: data}
+	google.ExpectUserResponse = true
+	return builder
+}
+
+// AskPermission asks the user for permissions, explaining why with reason,
+// e.g. "To find the nearest restaurant"
+// The answer is reported by PermissionGranted
+func (builder *Builder) AskPermission(reason string, permissions ...string) *Builder {
+	if len(permissions) == 0 {
+		builder.problem("permissions cannot be empty")
+	}
+	return builder.systemIntent("actions.intent.PERMISSION", map[string]interface{}{
+		"@type":       "type.googleapis.com/google.actions.v2.PermissionValueSpec",
+		"optContext":  reason,
+		"permissions": permissions,
+	})
+}
+
+// SignIn asks the user to link their account
+// The answer is reported by SignInStatus
+func (builder *Builder) SignIn() *Builder {
+	return builder.systemIntent("actions.intent.SIGN_IN", map[string]interface{}{
+		"@type": "type.googleapis.com/google.actions.v2.SignInValueSpec",
+	})
+}
+
+// Carousel asks the user to pick one of options, shown as a carousel
+// The selection is reported by SelectedOption
+func (builder *Builder) Carousel(options ...GoogleOption) *Builder {
+	builder.checkOptions("carousel", options, googleMaxCarouselItems)
+	return builder.systemIntent("actions.intent.OPTION", map[string]interface{}{
+		"@type":          "type.googleapis.com/google.actions.v2.OptionValueSpec",
+		"carouselSelect": map[string]interface{}{"items": optionItems(options)},
+	})
+}
+
+// List asks the user to pick one of options, shown as a list under title
+// The selection is reported by SelectedOption
+func (builder *Builder) List(title string, options ...GoogleOption) *Builder {
+	builder.checkOptions("list", options, googleMaxListItems)
+	return builder.systemIntent("actions.intent.OPTION", map[string]interface{}{
+		"@type":      "type.googleapis.com/google.actions.v2.OptionValueSpec",
+		"listSelect": map[string]interface{}{"title": title, "items": optionItems(options)},
+	})
+}
+
+func (builder *Builder) checkOptions(kind string, options []GoogleOption, most int) {
+	if len(options) < googleMinOptions || len(options) > most {
+		builder.problem("google %s needs %d to %d items, got %d", kind, googleMinOptions, most, len(options))
+	}
+
+	keys := make(map[string]bool)
+	for _, option := range options {
+		if option.Key == "" || option.Title == "" {
+			builder.problem("google %s items need a key and a title", kind)
+		}
+		if keys[option.Key] {
+			builder.problem("google %s has duplicate key %q", kind, option.Key)
+		}
+		keys[option.Key] = true
+	}
+}
+
+func optionItems(options []GoogleOption) []map[string]interface{} {
+	items := make([]map[string]interface{}, 0, len(options))
+	for _, option := range options {
+		items = append(items, option.item())
+	}
+	return items
+}
+
+// UserStorage sets the data kept by Actions on Google for the user across conversations
+func (builder *Builder) UserStorage(storage string) *Builder {
+	builder.google().UserStorage = storage
+	return builder
+}
+
+// googleProblems checks the Google payload as a whole
+func (builder *Builder) googleProblems() []string {
+	google, ok := builder.response.Data[PlatformGoogle].(*GooglePayload)
+	if !ok || google.RichResponse == nil {
+		return nil
+	}
+
+	items := google.RichResponse.Items
+	if (len(items) == 0 || items[0].SimpleResponse == nil) && builder.response.Speech == "" {
+		return []string{"google rich responses must start with a simple response"}
+	}
+	return nil
+}
+
+// finishGoogle returns a copy of payload whose rich response starts with a simple response,
+// taken from speech if needed
+func finishGoogle(payload *GooglePayload, speech, displayText string) *GooglePayload {
+	finished := *payload
+	if rich := payload.RichResponse; rich != nil && (len(rich.Items) == 0 || rich.Items[0].SimpleResponse == nil) {
+		copied := *rich
+		simple := GoogleItem{SimpleResponse: &GoogleSimple{TextToSpeech: speech, DisplayText: displayText}}
+		if strings.HasPrefix(strings.TrimSpace(speech), "<speak>") {
+			simple.SimpleResponse.TextToSpeech, simple.SimpleResponse.SSML = "", speech
+		}
+		copied.Items = append([]GoogleItem{simple}, rich.Items...)
+		finished.RichResponse = &copied
+	}
+	return &finished
+}
@@ -0,0 +1,151 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// ErrMissingParameter is returned when a parameter is absent or empty
+var ErrMissingParameter = errors.New("missing parameter")
+
+// Params are the parameters extracted by DialogFlow, with typed accessors
+// DialogFlow sends unfilled parameters as empty strings, which are treated as missing
+type Params map[string]interface{}
+
+// Params returns the parameters of the request's result
+func (request *Request) Params() Params {
+	return Params(request.Result.Parameters)
+}
+
+// Has reports whether the parameter name is present and not empty
+func (params Params) Has(name string) bool {
+	value, ok := params[name]
+	if !ok || value == nil {
+		return false
+	}
+	switch value := value.(type) {
+	case string:
+		return value != ""
+	case []interface{}:
+		return len(value) > 0
+	}
+	return true
+}
+
+func (params Params) lookup(name string) (interface{}, error) {
+	if !params.Has(name) {
+		return nil, fmt.Errorf("parameter %q: %w", name, ErrMissingParameter)
+	}
+	return params[name], nil
+}
+
+// String returns the parameter name as a string, or "" if it is missing
+func (params Params) String(name string) string {
+	value, err := params.lookup(name)
+	if err != nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// Float returns the parameter name as a number
+// Numbers sent as strings, as in protocol 20150910, are parsed
+func (params Params) Float(name string) (float64, error) {
+	value, err := params.lookup(name)
+	if err != nil {
+		return 0, err
+	}
+
+	switch value := value.(type) {
+	case float64:
+		return value, nil
+	case json.Number:
+		return value.Float64()
+	case string:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return 0, fmt.Errorf("parameter %q: %q is not a number", name, value)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("parameter %q: %T is not a number", name, value)
+}
+
+// Int returns the parameter name as an integer
+func (params Params) Int(name string) (int, error) {
+	f, err := params.Float(name)
+	if err != nil {
+		return 0, err
+	}
+	if f != float64(int(f)) {
+		return 0, fmt.Errorf("parameter %q: %v is not an integer", name, f)
+	}
+	return int(f), nil
+}
+
+// Bool returns the parameter name as a boolean
+func (params Params) Bool(name string) (bool, error) {
+	value, err := params.lookup(name)
+	if err != nil {
+		return false, err
+	}
+
+	switch value := value.(type) {
+	case bool:
+		return value, nil
+	case string:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return false, fmt.Errorf("parameter %q: %q is not a boolean", name, value)
+		}
+		return b, nil
+	}
+	return false, fmt.Errorf("parameter %q: %T is not a boolean", name, value)
+}
+
+// Strings returns a list parameter as strings
+// A single value is returned as a list of one
+func (params Params) Strings(name string) []string {
+	value, err := params.lookup(name)
+	if err != nil {
+		return nil
+	}
+
+	list, ok := value.([]interface{})
+	if !ok {
+		return []string{params.String(name)}
+	}
+
+	strings := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			strings = append(strings, s)
+		} else {
+			strings = append(strings, fmt.Sprint(item))
+		}
+	}
+	return strings
+}
+
+// Decode decodes the parameter name into v, e.g. a struct for composite
+// values such as @sys.unit-currency
+func (params Params) Decode(name string, v interface{}) error {
+	value, err := params.lookup(name)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("parameter %q: %w", name, err)
+	}
+	return nil
+}
@@ -0,0 +1,439 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// maxExchangeSize caps the size of a recorded line
+const maxExchangeSize = 4 << 20
+
+// Exchange is a recorded webhook request and the response it got
+type Exchange struct {
+	Time       time.Time `json:"time"`
+	DurationMS int64     `json:"durationMs"`
+	Request    *Request  `json:"request"`
+	Response   *Response `json:"response,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Redactor removes sensitive data from an exchange before it is recorded
+// It works on a copy, so it may modify the exchange freely
+type Redactor func(exchange *Exchange)
+
+// RedactParameters replaces the values of the named parameters, in the result and in every
+// context, with "REDACTED"
+// The values are also replaced wherever they appear in free text: the resolved query,
+// speech and messages, response data, event data and the integration's original request
+// Other data of the original request, e.g. user IDs, is kept and needs a Redactor of its own
+func RedactParameters(names ...string) Redactor {
+	return func(exchange *Exchange) {
+		var values []string
+		redact := func(parameters map[string]interface{}) {
+			for _, name := range names {
+				for _, key := range []string{name, name + ".original"} {
+					if value, ok := parameters[key]; ok {
+						values = appendStrings(values, value)
+						parameters[key] = "REDACTED"
+					}
+				}
+			}
+		}
+
+		if exchange.Request != nil {
+			redact(exchange.Request.Result.Parameters)
+			for _, context := range exchange.Request.Result.Contexts {
+				redact(context.Parameters)
+			}
+		}
+		if exchange.Response != nil {
+			for _, context := range exchange.Response.ContextOut {
+				redact(context.Parameters)
+			}
+		}
+
+		if len(values) == 0 {
+			return
+		}
+
+		// Longer values first, so that a value containing another one is replaced whole
+		sort.Slice(values, func(i, j int) bool {
+			return len(values[i]) > len(values[j])
+		})
+		replace := func(text string) string {
+			for _, value := range values {
+				text = strings.ReplaceAll(text, value, "REDACTED")
+			}
+			return text
+		}
+
+		if request := exchange.Request; request != nil {
+			request.Result.ResolvedQuery = replace(request.Result.ResolvedQuery)
+			request.Result.Fulfillment.Speech = replace(request.Result.Fulfillment.Speech)
+			redactMessages(request.Result.Fulfillment.Messages, replace)
+			for i, data := range request.Result.Fulfillment.Data {
+				request.Result.Fulfillment.Data[i] = redactValue(data, replace)
+			}
+
+			if original := request.OriginalRequest; original != nil && len(original.Data) > 0 {
+				var data interface{}
+				if json.Unmarshal(original.Data, &data) == nil {
+					original.Data, _ = json.Marshal(redactValue(data, replace))
+				} else {
+					original.Data = nil
+				}
+			}
+		}
+
+		if response := exchange.Response; response != nil {
+			response.Speech = replace(response.Speech)
+			response.DisplayText = replace(response.DisplayText)
+			redactMessages(response.Messages, replace)
+			for key, value := range response.Data {
+				response.Data[key] = redactValue(value, replace)
+			}
+			if event := response.FollowupEvent; event != nil {
+				for key, value := range event.Data {
+					event.Data[key] = replace(value)
+				}
+			}
+		}
+	}
+}
+
+// appendStrings appends the non-empty strings and numbers found in value, as they would
+// appear in text
+func appendStrings(strs []string, value interface{}) []string {
+	switch value := value.(type) {
+	case string:
+		if value != "" {
+			strs = append(strs, value)
+		}
+	case float64:
+		strs = append(strs, strconv.FormatFloat(value, 'f', -1, 64))
+	case map[string]interface{}:
+		for _, v := range value {
+			strs = appendStrings(strs, v)
+		}
+	case []interface{}:
+		for _, v := range value {
+			strs = appendStrings(strs, v)
+		}
+	}
+	return strs
+}
+
+// redactValue applies replace to every string in a decoded JSON value
+func redactValue(value interface{}, replace func(string) string) interface{} {
+	switch value := value.(type) {
+	case string:
+		return replace(value)
+	case map[string]interface{}:
+		for key, v := range value {
+			value[key] = redactValue(v, replace)
+		}
+	case []interface{}:
+		for i, v := range value {
+			value[i] = redactValue(v, replace)
+		}
+	}
+	return value
+}
+
+func redactMessages(messages []model.Message, replace func(string) string) {
+	for i := range messages {
+		message := &messages[i]
+		message.Speech = replace(message.Speech)
+		message.Title = replace(message.Title)
+		message.Subtitle = replace(message.Subtitle)
+		for r := range message.Replies {
+			message.Replies[r] = replace(message.Replies[r])
+		}
+		for b := range message.Buttons {
+			message.Buttons[b].Text = replace(message.Buttons[b].Text)
+			message.Buttons[b].Postback = replace(message.Buttons[b].Postback)
+		}
+		for key, value := range message.Payload {
+			message.Payload[key] = redactValue(value, replace)
+		}
+	}
+}
+
+// Record creates middleware that writes every request and response to w as JSON lines,
+// passing them through redact first if it is not nil
+func Record(w io.Writer, redact Redactor) Middleware {
+	var mu sync.Mutex
+	encoder := json.NewEncoder(w)
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, request *Request) (*Response, error) {
+			start := time.Now()
+			response, err := next.ServeWebhook(ctx, request)
+
+			exchange := Exchange{
+				Time:       start.UTC(),
+				DurationMS: time.Since(start).Milliseconds(),
+				Request:    request,
+				Response:   response,
+			}
+			if err != nil {
+				exchange.Error = err.Error()
+			}
+
+			if err := writeExchange(&mu, encoder, exchange, redact); err != nil {
+				log.Printf("webhook: could not record exchange: %v", err)
+			}
+			return response, err
+		})
+	}
+}
+
+func writeExchange(mu *sync.Mutex, encoder *json.Encoder, exchange Exchange, redact Redactor) error {
+	if redact != nil {
+		// Round trip through JSON so the redactor cannot touch the live request and response
+		data, err := json.Marshal(exchange)
+		if err != nil {
+			return err
+		}
+		exchange = Exchange{}
+		if err := json.Unmarshal(data, &exchange); err != nil {
+			return err
+		}
+		redact(&exchange)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	return encoder.Encode(exchange)
+}
+
+// ReadExchanges reads exchanges written by Record
+func ReadExchanges(r io.Reader) ([]Exchange, error) {
+	var exchanges []Exchange
+
+	decoder := json.NewDecoder(r)
+	for line := 1; ; line++ {
+		var exchange Exchange
+		err := decoder.Decode(&exchange)
+		if err == io.EOF {
+			return exchanges, nil
+		}
+		if err != nil {
+			return exchanges, fmt.Errorf("exchange %d: %v", line, err)
+		}
+		if exchange.Request == nil {
+			return exchanges, fmt.Errorf("exchange %d has no request", line)
+		}
+		exchanges = append(exchanges, exchange)
+	}
+}
+
+// RemoteHandler is a handler that forwards requests to the webhook at url
+type RemoteHandler struct {
+	URL    string
+	Client *http.Client
+	// Header is added to every request, e.g. for authentication
+	Header http.Header
+}
+
+// ServeWebhook posts request to the remote webhook and decodes its response
+func (remote *RemoteHandler) ServeWebhook(ctx context.Context, request *Request) (*Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, remote.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range remote.Header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	client := remote.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(res.Body, maxExchangeSize))
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= 400 {
+		var failed errorBody
+		var failedV2 v2ErrorBody
+		message := strings.TrimSpace(string(data))
+		if json.Unmarshal(data, &failed) == nil && failed.Status.ErrorDetails != "" {
+			message = failed.Status.ErrorDetails
+		} else if json.Unmarshal(data, &failedV2) == nil && failedV2.WebhookStatus.Message != "" {
+			message = failedV2.WebhookStatus.Message
+		}
+		return nil, &Error{Code: res.StatusCode, Message: message}
+	}
+
+	var response Response
+	if err := json.Unmarshal(data, &response); err != nil {
+		return nil, fmt.Errorf("invalid webhook response: %v", err)
+	}
+	return &response, nil
+}
+
+// ReplayResult is the outcome of replaying an exchange
+type ReplayResult struct {
+	Exchange Exchange
+	Response *Response
+	Err      error
+	// Differences describe how the new response differs from the recorded one
+	Differences []string
+}
+
+// Replay sends the recorded requests to handler in order and compares the responses
+// Fields at the JSON paths in ignore, e.g. "data.google.conversationToken", are not compared
+func Replay(ctx context.Context, handler Handler, exchanges []Exchange, ignore ...string) []ReplayResult {
+	results := make([]ReplayResult, 0, len(exchanges))
+
+	for _, exchange := range exchanges {
+		request := *exchange.Request
+		response, err := handler.ServeWebhook(ctx, &request)
+
+		result := ReplayResult{Exchange: exchange, Response: response, Err: err}
+		switch {
+		case err != nil && exchange.Error == "":
+			result.Differences = []string{"error: " + err.Error()}
+		case err == nil && exchange.Error != "":
+			result.Differences = []string{fmt.Sprintf("error: expected %q", exchange.Error)}
+		case err == nil:
+			result.Differences = DiffResponses(exchange.Response, response, ignore...)
+		}
+		results = append(results, result)
+
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return results
+}
+
+// DiffResponses compares two responses field by field, by their JSON encoding,
+// and describes every difference with its path
+func DiffResponses(want, got *Response, ignore ...string) []string {
+	var wantValue, gotValue interface{}
+	if err := jsonValue(want, &wantValue); err != nil {
+		return []string{err.Error()}
+	}
+	if err := jsonValue(got, &gotValue); err != nil {
+		return []string{err.Error()}
+	}
+
+	ignored := make(map[string]bool, len(ignore))
+	for _, path := range ignore {
+		ignored[path] = true
+	}
+
+	var differences []string
+	diffValues("", wantValue, gotValue, ignored, &differences)
+	return differences
+}
+
+func jsonValue(response *Response, v *interface{}) error {
+	if response == nil {
+		response = &Response{}
+	}
+	data, err := json.Marshal(response)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func diffValues(path string, want, got interface{}, ignored map[string]bool, differences *[]string) {
+	if ignored[path] {
+		return
+	}
+
+	switch want := want.(type) {
+	case map[string]interface{}:
+		if got, ok := got.(map[string]interface{}); ok {
+			keys := make(map[string]bool)
+			for key := range want {
+				keys[key] = true
+			}
+			for key := range got {
+				keys[key] = true
+			}
+			sorted := make([]string, 0, len(keys))
+			for key := range keys {
+				sorted = append(sorted, key)
+			}
+			sort.Strings(sorted)
+
+			for _, key := range sorted {
+				diffValues(joinPath(path, key), want[key], got[key], ignored, differences)
+			}
+			return
+		}
+
+	case []interface{}:
+		if got, ok := got.([]interface{}); ok {
+			for i := 0; i < max(len(want), len(got)); i++ {
+				var wantItem, gotItem interface{}
+				if i < len(want) {
+					wantItem = want[i]
+				}
+				if i < len(got) {
+					gotItem = got[i]
+				}
+				diffValues(fmt.Sprintf("%s[%d]", path, i), wantItem, gotItem, ignored, differences)
+			}
+			return
+		}
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		*differences = append(*differences, fmt.Sprintf("%s: expected %s, got %s", displayPath(path), encodeValue(want), encodeValue(got)))
+	}
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func displayPath(path string) string {
+	if path == "" {
+		return "response"
+	}
+	return path
+}
+
+func encodeValue(v interface{}) string {
+	if v == nil {
+		return "nothing"
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
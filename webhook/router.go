@@ -0,0 +1,220 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(Handler) Handler
+
+// Chain wraps handler with middleware, the first being the outermost
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// Responder produces a webhook response, e.g. a *Response or a response builder
+type Responder interface {
+	WebhookResponse() (*Response, error)
+}
+
+// WebhookResponse returns response itself
+func (response *Response) WebhookResponse() (*Response, error) {
+	return response, nil
+}
+
+// ActionFunc is a handler receiving the request's parameters and returning a Responder
+type ActionFunc func(ctx context.Context, request *Request, params Params) (Responder, error)
+
+// ServeWebhook calls fn and builds its response
+func (fn ActionFunc) ServeWebhook(ctx context.Context, request *Request) (*Response, error) {
+	responder, err := fn(ctx, request, request.Params())
+	if err != nil || responder == nil {
+		return nil, err
+	}
+	return responder.WebhookResponse()
+}
+
+type routeKind int
+
+const (
+	actionRoute routeKind = iota
+	intentRoute
+	contextRoute
+)
+
+type route struct {
+	kind       routeKind
+	pattern    string
+	handler    Handler
+	middleware []Middleware
+	group      *Router
+}
+
+// wildcard reports whether the route's pattern has glob characters
+func (r *route) wildcard() bool {
+	return strings.ContainsAny(r.pattern, "*?[")
+}
+
+func (r *route) matches(request *Request) bool {
+	switch r.kind {
+	case actionRoute:
+		if r.wildcard() {
+			matched, _ := path.Match(r.pattern, request.Result.Action)
+			return matched
+		}
+		return r.pattern == request.Result.Action
+	case intentRoute:
+		return r.pattern == request.Result.Metadata.IntentName
+	default:
+		_, ok := request.Context(r.pattern)
+		return ok
+	}
+}
+
+// routeTable holds the routes shared by a router and its groups
+type routeTable struct {
+	mu       sync.RWMutex
+	routes   []*route
+	fallback *route
+}
+
+// Router dispatches webhook requests to handlers by action, intent name or input context
+//
+// Routes are tried in this order:
+// exact actions, intent names, wildcard actions from the longest pattern,
+// input contexts in registration order, and finally the fallback
+type Router struct {
+	table      *routeTable
+	parent     *Router
+	prefix     string
+	middleware []Middleware
+}
+
+// NewRouter creates an empty router
+func NewRouter() *Router {
+	return &Router{table: &routeTable{}}
+}
+
+// Use adds middleware to every route of the router and its groups
+func (router *Router) Use(middleware ...Middleware) {
+	router.table.mu.Lock()
+	defer router.table.mu.Unlock()
+	router.middleware = append(router.middleware, middleware...)
+}
+
+// Group creates a group of routes sharing the router's routes and middleware
+// The prefix is prepended to the action patterns registered on the group, e.g. "booking."
+func (router *Router) Group(prefix string, middleware ...Middleware) *Router {
+	return &Router{
+		table:      router.table,
+		parent:     router,
+		prefix:     router.prefix + prefix,
+		middleware: middleware,
+	}
+}
+
+func (router *Router) add(r *route) {
+	r.group = router
+	router.table.mu.Lock()
+	defer router.table.mu.Unlock()
+	router.table.routes = append(router.table.routes, r)
+}
+
+// Action routes requests whose action matches pattern
+// Patterns may use the wildcards of path.Match, e.g. "booking.*"
+func (router *Router) Action(pattern string, handler Handler, middleware ...Middleware) {
+	router.add(&route{kind: actionRoute, pattern: router.prefix + pattern, handler: handler, middleware: middleware})
+}
+
+// Intent routes requests matched to the intent called name
+func (router *Router) Intent(name string, handler Handler, middleware ...Middleware) {
+	router.add(&route{kind: intentRoute, pattern: name, handler: handler, middleware: middleware})
+}
+
+// Context routes requests with the input context called name active
+func (router *Router) Context(name string, handler Handler, middleware ...Middleware) {
+	router.add(&route{kind: contextRoute, pattern: name, handler: handler, middleware: middleware})
+}
+
+// Fallback sets the handler for requests that match no route
+func (router *Router) Fallback(handler Handler, middleware ...Middleware) {
+	router.table.mu.Lock()
+	defer router.table.mu.Unlock()
+	router.table.fallback = &route{handler: handler, middleware: middleware, group: router}
+}
+
+// match returns the route for request, or nil
+func (router *Router) match(request *Request) *route {
+	router.table.mu.RLock()
+	defer router.table.mu.RUnlock()
+
+	var wildcards []*route
+	for _, kind := range []routeKind{actionRoute, intentRoute} {
+		for _, r := range router.table.routes {
+			if r.kind != kind {
+				continue
+			}
+			if kind == actionRoute && r.wildcard() {
+				wildcards = append(wildcards, r)
+				continue
+			}
+			if r.matches(request) {
+				return r
+			}
+		}
+	}
+
+	sort.SliceStable(wildcards, func(i, j int) bool {
+		return len(wildcards[i].pattern) > len(wildcards[j].pattern)
+	})
+	for _, r := range wildcards {
+		if r.matches(request) {
+			return r
+		}
+	}
+
+	for _, r := range router.table.routes {
+		if r.kind == contextRoute && r.matches(request) {
+			return r
+		}
+	}
+
+	return router.table.fallback
+}
+
+// chain wraps the route's handler with its middleware, then the middleware of its groups
+func (r *route) chain() Handler {
+	handler := Chain(r.handler, r.middleware...)
+	for group := r.group; group != nil; group = group.parent {
+		handler = Chain(handler, group.middleware...)
+	}
+	return handler
+}
+
+// ServeWebhook dispatches request to the matching route
+func (router *Router) ServeWebhook(ctx context.Context, request *Request) (*Response, error) {
+	r := router.match(request)
+	if r == nil {
+		return nil, &Error{Code: http.StatusNotFound, Message: fmt.Sprintf("no route for action %q", request.Result.Action)}
+	}
+
+	router.table.mu.RLock()
+	handler := r.chain()
+	router.table.mu.RUnlock()
+
+	return handler.ServeWebhook(ctx, request)
+}
+
+// ServeHTTP decodes webhook requests and dispatches them
+func (router *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	NewHandler(router).ServeHTTP(w, r)
+}
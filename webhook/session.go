@@ -0,0 +1,397 @@
+package webhook
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// ErrVersionConflict is returned when saving a session that was saved by someone else
+// since it was loaded
+var ErrVersionConflict = errors.New("session was modified concurrently")
+
+// Session is the state kept for a DialogFlow session between webhook calls
+type Session struct {
+	ID string `json:"id"`
+	// Version is incremented by every save, 0 for a session that was never saved
+	Version   int64                      `json:"version"`
+	Values    map[string]json.RawMessage `json:"values,omitempty"`
+	UpdatedAt time.Time                  `json:"updatedAt"`
+	dirty     bool
+}
+
+// Get decodes the value stored under key into v, and reports whether it exists
+func (session *Session) Get(key string, v interface{}) (bool, error) {
+	data, ok := session.Values[key]
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return true, fmt.Errorf("session value %q: %w", key, err)
+	}
+	return true, nil
+}
+
+// Set stores v under key
+func (session *Session) Set(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("session value %q: %w", key, err)
+	}
+	if session.Values == nil {
+		session.Values = make(map[string]json.RawMessage)
+	}
+	session.Values[key] = data
+	session.dirty = true
+	return nil
+}
+
+// Delete removes the value stored under key
+func (session *Session) Delete(key string) {
+	if _, ok := session.Values[key]; ok {
+		delete(session.Values, key)
+		session.dirty = true
+	}
+}
+
+// Modified reports whether the session was changed since it was loaded
+func (session *Session) Modified() bool {
+	return session.dirty
+}
+
+func (session Session) copy() Session {
+	values := make(map[string]json.RawMessage, len(session.Values))
+	for key, value := range session.Values {
+		values[key] = value
+	}
+	session.Values = values
+	session.dirty = false
+	return session
+}
+
+// SessionStore persists sessions with optimistic concurrency
+type SessionStore interface {
+	// Load returns the session with ID id, or an empty session if none is stored
+	Load(ctx context.Context, id string) (Session, error)
+	// Save stores session and increments its version,
+	// failing with ErrVersionConflict if the stored version is not session.Version
+	Save(ctx context.Context, session *Session) error
+	// Delete removes the session with ID id
+	Delete(ctx context.Context, id string) error
+}
+
+type storedSession struct {
+	session Session
+	expires time.Time
+}
+
+// MemorySessionStore keeps sessions in memory until they expire
+type MemorySessionStore struct {
+	mu       sync.Mutex
+	ttl      time.Duration
+	sessions map[string]storedSession
+}
+
+// NewMemorySessionStore creates a session store dropping sessions that are not saved for ttl
+// A ttl of 0 keeps sessions forever
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{ttl: ttl, sessions: make(map[string]storedSession)}
+}
+
+// Load returns a copy of the session with ID id
+func (store *MemorySessionStore) Load(ctx context.Context, id string) (Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, ok := store.sessions[id]
+	if !ok || store.expired(stored, time.Now()) {
+		delete(store.sessions, id)
+		return Session{ID: id}, nil
+	}
+	return stored.session.copy(), nil
+}
+
+// Save stores a copy of session
+func (store *MemorySessionStore) Save(ctx context.Context, session *Session) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	var version int64
+	if stored, ok := store.sessions[session.ID]; ok && !store.expired(stored, now) {
+		version = stored.session.Version
+	}
+	if version != session.Version {
+		return ErrVersionConflict
+	}
+
+	session.Version++
+	session.UpdatedAt = now
+	session.dirty = false
+	store.sessions[session.ID] = storedSession{session: session.copy(), expires: now.Add(store.ttl)}
+	return nil
+}
+
+// Delete removes the session with ID id
+func (store *MemorySessionStore) Delete(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	delete(store.sessions, id)
+	return nil
+}
+
+// Expire drops the expired sessions and returns how many were dropped
+func (store *MemorySessionStore) Expire() int {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	now := time.Now()
+	expired := 0
+	for id, stored := range store.sessions {
+		if store.expired(stored, now) {
+			delete(store.sessions, id)
+			expired++
+		}
+	}
+	return expired
+}
+
+func (store *MemorySessionStore) expired(stored storedSession, now time.Time) bool {
+	return store.ttl > 0 && now.After(stored.expires)
+}
+
+// FileSessionStore stores sessions as JSON files in a directory
+// Versions are only checked between users of the same store
+type FileSessionStore struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+}
+
+// NewFileSessionStore creates a session store in dir, creating the directory if needed
+// Sessions not saved for ttl are treated as missing, a ttl of 0 keeps them forever
+func NewFileSessionStore(dir string, ttl time.Duration) (*FileSessionStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir cannot be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &FileSessionStore{dir: dir, ttl: ttl}, nil
+}
+
+// Load reads the session with ID id
+func (store *FileSessionStore) Load(ctx context.Context, id string) (Session, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	return store.load(id)
+}
+
+func (store *FileSessionStore) load(id string) (Session, error) {
+	session := Session{ID: id}
+
+	data, err := ioutil.ReadFile(store.path(id))
+	if os.IsNotExist(err) {
+		return session, nil
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if err := json.Unmarshal(data, &session); err != nil {
+		return Session{ID: id}, err
+	}
+	if store.ttl > 0 && time.Since(session.UpdatedAt) > store.ttl {
+		return Session{ID: id}, os.Remove(store.path(id))
+	}
+	return session, nil
+}
+
+// Save writes session to the directory
+func (store *FileSessionStore) Save(ctx context.Context, session *Session) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	stored, err := store.load(session.ID)
+	if err != nil {
+		return err
+	}
+	if stored.Version != session.Version {
+		return ErrVersionConflict
+	}
+
+	saved := *session
+	saved.Version++
+	saved.UpdatedAt = time.Now()
+
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := store.path(session.ID) + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, store.path(session.ID)); err != nil {
+		return err
+	}
+
+	session.Version, session.UpdatedAt, session.dirty = saved.Version, saved.UpdatedAt, false
+	return nil
+}
+
+// Delete removes the session with ID id
+func (store *FileSessionStore) Delete(ctx context.Context, id string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	err := os.Remove(store.path(id))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// path names session files by the hash of their ID, which may contain any character
+func (store *FileSessionStore) path(id string) string {
+	hash := sha256.Sum256([]byte(id))
+	return filepath.Join(store.dir, hex.EncodeToString(hash[:])+".json")
+}
+
+type sessionKey struct{}
+
+// SessionFrom returns the session loaded by the Sessions middleware, or nil
+func SessionFrom(ctx context.Context) *Session {
+	session, _ := ctx.Value(sessionKey{}).(*Session)
+	return session
+}
+
+// SessionConfig configures the Sessions middleware
+type SessionConfig struct {
+	// Retries is how many times a handler is run again when its session was modified
+	// by a concurrent turn, 0 to fail the request instead
+	Retries int
+	// MirrorContext, if set, is the name of an output context that carries the session's values,
+	// so that they survive in the conversation when they are missing from the store
+	MirrorContext string
+	// MirrorLifespan is the lifespan of the mirror context, 5 if zero
+	MirrorLifespan int
+	// MirrorLimit is the largest encoded state that is mirrored, in bytes, 1000 if zero
+	MirrorLimit int
+}
+
+// Sessions creates middleware that loads the session of every request from store,
+// makes it available through SessionFrom and saves it if the handler modified it
+func Sessions(store SessionStore, config SessionConfig) Middleware {
+	if config.MirrorLifespan <= 0 {
+		config.MirrorLifespan = 5
+	}
+	if config.MirrorLimit <= 0 {
+		config.MirrorLimit = 1000
+	}
+
+	return func(next Handler) Handler {
+		return HandlerFunc(func(ctx context.Context, request *Request) (*Response, error) {
+			if request.SessionID == "" {
+				return next.ServeWebhook(ctx, request)
+			}
+
+			for attempt := 0; ; attempt++ {
+				session, err := store.Load(ctx, request.SessionID)
+				if err != nil {
+					return nil, fmt.Errorf("could not load session: %w", err)
+				}
+				if session.Version == 0 && config.MirrorContext != "" {
+					restoreMirror(&session, request, config.MirrorContext)
+				}
+
+				response, err := next.ServeWebhook(context.WithValue(ctx, sessionKey{}, &session), request)
+				if err != nil {
+					return nil, err
+				}
+
+				if session.dirty {
+					err = store.Save(ctx, &session)
+					if errors.Is(err, ErrVersionConflict) {
+						if attempt < config.Retries {
+							continue
+						}
+						return nil, &Error{Code: http.StatusConflict, Message: err.Error()}
+					}
+					if err != nil {
+						return nil, fmt.Errorf("could not save session: %w", err)
+					}
+				}
+
+				if config.MirrorContext != "" {
+					response = mirror(response, session, config)
+				}
+				return response, nil
+			}
+		})
+	}
+}
+
+// restoreMirror fills session from the mirror context of request
+func restoreMirror(session *Session, request *Request, name string) {
+	context, ok := request.Context(name)
+	if !ok {
+		return
+	}
+
+	state, _ := context.Parameters["state"].(string)
+	var values map[string]json.RawMessage
+	if json.Unmarshal([]byte(state), &values) == nil && len(values) > 0 {
+		session.Values = values
+		session.dirty = true
+	}
+}
+
+// mirror adds the session's values to a copy of response as an output context, if they are
+// small enough
+// The handler's response is left untouched, as it may be shared, e.g. a fallback
+func mirror(response *Response, session Session, config SessionConfig) *Response {
+	if len(session.Values) == 0 {
+		return response
+	}
+
+	state, err := json.Marshal(session.Values)
+	if err != nil || len(state) > config.MirrorLimit {
+		return response
+	}
+
+	mirrored := &Response{}
+	if response != nil {
+		*mirrored = *response
+	}
+	mirrored.ContextOut = append([]model.Context(nil), mirrored.ContextOut...)
+
+	context := model.Context{
+		Name:       config.MirrorContext,
+		Lifespan:   config.MirrorLifespan,
+		Parameters: map[string]interface{}{"state": string(state)},
+	}
+	for i, existing := range mirrored.ContextOut {
+		if strings.EqualFold(existing.Name, config.MirrorContext) {
+			mirrored.ContextOut[i] = context
+			return mirrored
+		}
+	}
+	mirrored.ContextOut = append(mirrored.ContextOut, context)
+	return mirrored
+}
@@ -0,0 +1,146 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// racingStore saves a concurrent turn of the session before the first saves it lets through
+type racingStore struct {
+	*MemorySessionStore
+	races int
+}
+
+func (store *racingStore) Save(ctx context.Context, session *Session) error {
+	if store.races > 0 {
+		store.races--
+		concurrent, _ := store.Load(ctx, session.ID)
+		concurrent.Set("concurrent", true)
+		if err := store.MemorySessionStore.Save(ctx, &concurrent); err != nil {
+			return err
+		}
+	}
+	return store.MemorySessionStore.Save(ctx, session)
+}
+
+// countingHandler increments the session's turns
+func countingHandler(calls *int) Handler {
+	return HandlerFunc(func(ctx context.Context, request *Request) (*Response, error) {
+		*calls++
+		session := SessionFrom(ctx)
+		var turns int
+		session.Get("turns", &turns)
+		session.Set("turns", turns+1)
+		return &Response{Speech: "ok"}, nil
+	})
+}
+
+func TestSessionsRetryVersionConflicts(t *testing.T) {
+	store := &racingStore{MemorySessionStore: NewMemorySessionStore(0), races: 1}
+	var calls int
+	handler := Sessions(store, SessionConfig{Retries: 1})(countingHandler(&calls))
+
+	if _, err := handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d handler calls, want 2", calls)
+	}
+
+	// The retry ran on the concurrently saved session, keeping its changes
+	session, _ := store.Load(context.Background(), "session-1")
+	var concurrent bool
+	var turns int
+	session.Get("concurrent", &concurrent)
+	session.Get("turns", &turns)
+	if !concurrent || turns != 1 || session.Version != 2 {
+		t.Errorf("got concurrent %v turns %d version %d, want true 1 2", concurrent, turns, session.Version)
+	}
+
+	// Conflicts beyond the retries fail the request
+	store.races = 2
+	calls = 0
+	_, err := handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1"})
+	var webhookErr *Error
+	if !errors.As(err, &webhookErr) || webhookErr.Code != http.StatusConflict {
+		t.Errorf("got %v, want a 409 *Error", err)
+	}
+	if calls != 2 {
+		t.Errorf("got %d handler calls, want 2", calls)
+	}
+}
+
+func TestSessionsMirror(t *testing.T) {
+	store := NewMemorySessionStore(0)
+	fallback := &Response{Speech: "ok"}
+	handler := Sessions(store, SessionConfig{MirrorContext: "session-state"})(HandlerFunc(
+		func(ctx context.Context, request *Request) (*Response, error) {
+			session := SessionFrom(ctx)
+			var cart []string
+			session.Get("cart", &cart)
+			session.Set("cart", append(cart, request.Result.ResolvedQuery))
+			return fallback, nil
+		}))
+
+	// The store lost the session, which is restored from the mirror context
+	request := &Request{SessionID: "session-1", Result: model.Result{
+		ResolvedQuery: "cola",
+		Contexts: []model.Context{
+			{Name: "session-state", Lifespan: 3, Parameters: map[string]interface{}{"state": `{"cart":["pizza"]}`}},
+		},
+	}}
+	response, err := handler.ServeWebhook(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	session, _ := store.Load(context.Background(), "session-1")
+	var cart []string
+	session.Get("cart", &cart)
+	if want := []string{"pizza", "cola"}; !reflect.DeepEqual(cart, want) {
+		t.Errorf("got stored cart %q, want %q", cart, want)
+	}
+
+	want := []model.Context{
+		{Name: "session-state", Lifespan: 5, Parameters: map[string]interface{}{"state": `{"cart":["pizza","cola"]}`}},
+	}
+	if !reflect.DeepEqual(response.ContextOut, want) {
+		t.Errorf("got contexts %+v, want %+v", response.ContextOut, want)
+	}
+	if fallback.ContextOut != nil {
+		t.Errorf("mirroring changed the handler's response")
+	}
+
+	// A stored session wins over a stale mirror
+	request.Result.ResolvedQuery = "fries"
+	if _, err := handler.ServeWebhook(context.Background(), request); err != nil {
+		t.Fatal(err)
+	}
+	session, _ = store.Load(context.Background(), "session-1")
+	cart = nil
+	session.Get("cart", &cart)
+	if want := []string{"pizza", "cola", "fries"}; !reflect.DeepEqual(cart, want) {
+		t.Errorf("got stored cart %q, want %q", cart, want)
+	}
+}
+
+func TestSessionsMirrorLimit(t *testing.T) {
+	handler := Sessions(NewMemorySessionStore(0), SessionConfig{MirrorContext: "session-state", MirrorLimit: 10})(HandlerFunc(
+		func(ctx context.Context, request *Request) (*Response, error) {
+			SessionFrom(ctx).Set("note", "longer than ten bytes")
+			return &Response{ContextOut: []model.Context{{Name: "other", Lifespan: 1}}}, nil
+		}))
+
+	response, err := handler.ServeWebhook(context.Background(), &Request{SessionID: "session-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []model.Context{{Name: "other", Lifespan: 1}}; !reflect.DeepEqual(response.ContextOut, want) {
+		t.Errorf("got contexts %+v, want %+v", response.ContextOut, want)
+	}
+}
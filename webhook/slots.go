@@ -0,0 +1,202 @@
+package webhook
+
+import (
+	"context"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// dialogContextSuffix ends the names of the contexts DialogFlow keeps while filling slots,
+// <intent>_dialog_context and <intent id>_id_dialog_context
+const dialogContextSuffix = "_dialog_context"
+
+// IntentParameters returns the parameters declared by the responses of intent
+func IntentParameters(intent model.Intent) []model.Parameter {
+	var parameters []model.Parameter
+	seen := make(map[string]bool)
+	for _, response := range intent.Responses {
+		for _, parameter := range response.Parameters {
+			if !seen[parameter.Name] {
+				seen[parameter.Name] = true
+				parameters = append(parameters, parameter)
+			}
+		}
+	}
+	return parameters
+}
+
+// Slots is the state of a slot-filling turn
+type Slots struct {
+	Request    *Request
+	Params     Params
+	parameters []model.Parameter
+	overrides  map[string]interface{}
+	cleared    []string
+}
+
+// NewSlots creates the slot-filling state of request, for an intent with parameters
+func NewSlots(request *Request, parameters []model.Parameter) *Slots {
+	params := make(Params, len(request.Result.Parameters))
+	for name, value := range request.Result.Parameters {
+		params[name] = value
+	}
+	return &Slots{Request: request, Params: params, parameters: parameters, overrides: make(map[string]interface{})}
+}
+
+// Missing returns the required parameters that are not filled yet, in declaration order
+func (slots *Slots) Missing() []string {
+	var missing []string
+	for _, parameter := range slots.parameters {
+		if parameter.Required && !slots.Params.Has(parameter.Name) {
+			missing = append(missing, parameter.Name)
+		}
+	}
+	return missing
+}
+
+// Filled returns the parameters that are filled, in declaration order
+func (slots *Slots) Filled() []string {
+	var filled []string
+	for _, parameter := range slots.parameters {
+		if slots.Params.Has(parameter.Name) {
+			filled = append(filled, parameter.Name)
+		}
+	}
+	return filled
+}
+
+// Complete reports whether every required parameter is filled
+func (slots *Slots) Complete() bool {
+	return len(slots.Missing()) == 0
+}
+
+// Set overrides the value of the parameter name for the rest of the slot filling
+func (slots *Slots) Set(name string, value interface{}) {
+	slots.Params[name] = value
+	slots.overrides[name] = value
+}
+
+// Clear empties the parameter name, so DialogFlow prompts for it again
+func (slots *Slots) Clear(name string) {
+	slots.Set(name, "")
+	if !containsName(slots.cleared, name) {
+		slots.cleared = append(slots.cleared, name)
+	}
+}
+
+func containsName(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// contextOut returns the dialog contexts updated with the overridden parameters
+func (slots *Slots) contextOut() []model.Context {
+	if len(slots.overrides) == 0 {
+		return nil
+	}
+
+	var contexts []model.Context
+	var prefix string
+	for _, context := range slots.Request.Result.Contexts {
+		name := strings.ToLower(context.Name)
+		if !strings.HasSuffix(name, dialogContextSuffix) {
+			continue
+		}
+		if !strings.HasSuffix(name, "_id"+dialogContextSuffix) {
+			prefix = strings.TrimSuffix(name, dialogContextSuffix)
+		}
+
+		parameters := make(map[string]interface{}, len(context.Parameters)+len(slots.overrides))
+		for name, value := range context.Parameters {
+			parameters[name] = value
+		}
+		for name, value := range slots.overrides {
+			parameters[name] = value
+			parameters[name+".original"] = value
+		}
+		contexts = append(contexts, model.Context{Name: context.Name, Lifespan: context.Lifespan, Parameters: parameters})
+	}
+
+	// Asks DialogFlow to prompt for the first cleared parameter
+	if prefix != "" && len(slots.cleared) > 0 {
+		contexts = append(contexts, model.Context{Name: prefix + "_dialog_params_" + slots.cleared[0], Lifespan: 1})
+	}
+
+	return contexts
+}
+
+// Response returns a builder carrying the parameter overrides, with no message of its own
+// so that DialogFlow asks its own prompt
+// It builds even without overrides, as an empty reply to a slot filling call is valid
+func (slots *Slots) Response() *Builder {
+	builder := NewBuilder()
+	builder.response.ContextOut = slots.contextOut()
+	builder.mayBeEmpty = true
+	return builder
+}
+
+// Reprompt returns a builder that asks message instead of DialogFlow's prompt
+func (slots *Slots) Reprompt(message string) *Builder {
+	return slots.Response().Text(message)
+}
+
+// Validator checks the filled parameter name, returning a message to prompt for it again
+// if the value is not acceptable
+type Validator func(ctx context.Context, slots *Slots, name string) (reprompt string, err error)
+
+// SlotFilling handles the webhook calls of an intent with webhook slot filling enabled
+type SlotFilling struct {
+	// Parameters are the parameters of the intent, see IntentParameters
+	Parameters []model.Parameter
+	// Validators check filled parameters by name
+	// An invalid parameter is cleared and prompted for again with the validator's message
+	Validators map[string]Validator
+	// Prompt handles turns that still miss required parameters
+	// If nil DialogFlow asks its own prompts
+	Prompt func(ctx context.Context, slots *Slots) (Responder, error)
+	// Complete handles the request once every required parameter is filled
+	Complete func(ctx context.Context, slots *Slots) (Responder, error)
+}
+
+// ServeWebhook validates the filled parameters, then prompts or completes the intent
+func (filling *SlotFilling) ServeWebhook(ctx context.Context, request *Request) (*Response, error) {
+	slots := NewSlots(request, filling.Parameters)
+
+	for _, name := range slots.Filled() {
+		validator := filling.Validators[name]
+		if validator == nil {
+			continue
+		}
+
+		reprompt, err := validator(ctx, slots, name)
+		if err != nil {
+			return nil, err
+		}
+		if reprompt != "" {
+			slots.Clear(name)
+			return slots.Reprompt(reprompt).WebhookResponse()
+		}
+	}
+
+	var respond func(ctx context.Context, slots *Slots) (Responder, error)
+	if !request.Result.ActionIncomplete && slots.Complete() {
+		respond = filling.Complete
+	} else {
+		respond = filling.Prompt
+	}
+
+	if respond == nil {
+		return &Response{ContextOut: slots.contextOut()}, nil
+	}
+
+	responder, err := respond(ctx, slots)
+	if err != nil || responder == nil {
+		return nil, err
+	}
+	return responder.WebhookResponse()
+}
@@ -0,0 +1,462 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// V2Request is the body of a DialogFlow v2 webhook call
+type V2Request struct {
+	ResponseID                  string             `json:"responseId,omitempty"`
+	Session                     string             `json:"session"`
+	QueryResult                 V2QueryResult      `json:"queryResult"`
+	OriginalDetectIntentRequest *V2OriginalRequest `json:"originalDetectIntentRequest,omitempty"`
+}
+
+// V2OriginalRequest is the request received by DialogFlow v2 from an integration
+type V2OriginalRequest struct {
+	Source  string                 `json:"source,omitempty"`
+	Version string                 `json:"version,omitempty"`
+	Payload map[string]interface{} `json:"payload,omitempty"`
+}
+
+// V2QueryResult is the result of a v2 query
+type V2QueryResult struct {
+	QueryText                 string                 `json:"queryText,omitempty"`
+	LanguageCode              string                 `json:"languageCode,omitempty"`
+	Action                    string                 `json:"action,omitempty"`
+	Parameters                map[string]interface{} `json:"parameters,omitempty"`
+	AllRequiredParamsPresent  bool                   `json:"allRequiredParamsPresent,omitempty"`
+	FulfillmentText           string                 `json:"fulfillmentText,omitempty"`
+	FulfillmentMessages       []V2Message            `json:"fulfillmentMessages,omitempty"`
+	WebhookSource             string                 `json:"webhookSource,omitempty"`
+	WebhookPayload            map[string]interface{} `json:"webhookPayload,omitempty"`
+	OutputContexts            []V2Context            `json:"outputContexts,omitempty"`
+	Intent                    *V2Intent              `json:"intent,omitempty"`
+	IntentDetectionConfidence float32                `json:"intentDetectionConfidence,omitempty"`
+}
+
+// V2Intent identifies the intent matched by a v2 query
+type V2Intent struct {
+	// Name is the intent's path, projects/<project>/agent/intents/<id>
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+// V2Context is a v2 context, named by its full path,
+// projects/<project>/agent/sessions/<session>/contexts/<name>
+// Its lifespan count is always encoded, since 0 removes the context
+type V2Context struct {
+	Name          string                 `json:"name"`
+	LifespanCount int                    `json:"lifespanCount"`
+	Parameters    map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// V2Message is a v2 rich message, with exactly one of its message fields set
+type V2Message struct {
+	Platform     string                 `json:"platform,omitempty"`
+	Text         *V2Text                `json:"text,omitempty"`
+	Image        *V2Image               `json:"image,omitempty"`
+	QuickReplies *V2QuickReplies        `json:"quickReplies,omitempty"`
+	Card         *V2Card                `json:"card,omitempty"`
+	Payload      map[string]interface{} `json:"payload,omitempty"`
+}
+
+type V2Text struct {
+	Text []string `json:"text,omitempty"`
+}
+
+type V2Image struct {
+	ImageURI          string `json:"imageUri,omitempty"`
+	AccessibilityText string `json:"accessibilityText,omitempty"`
+}
+
+type V2QuickReplies struct {
+	Title        string   `json:"title,omitempty"`
+	QuickReplies []string `json:"quickReplies,omitempty"`
+}
+
+type V2Card struct {
+	Title    string         `json:"title,omitempty"`
+	Subtitle string         `json:"subtitle,omitempty"`
+	ImageURI string         `json:"imageUri,omitempty"`
+	Buttons  []V2CardButton `json:"buttons,omitempty"`
+}
+
+type V2CardButton struct {
+	Text     string `json:"text,omitempty"`
+	Postback string `json:"postback,omitempty"`
+}
+
+// V2Response is the body of a v2 webhook reply
+type V2Response struct {
+	FulfillmentText     string                 `json:"fulfillmentText,omitempty"`
+	FulfillmentMessages []V2Message            `json:"fulfillmentMessages,omitempty"`
+	Source              string                 `json:"source,omitempty"`
+	Payload             map[string]interface{} `json:"payload,omitempty"`
+	OutputContexts      []V2Context            `json:"outputContexts,omitempty"`
+	FollowupEventInput  *V2EventInput          `json:"followupEventInput,omitempty"`
+}
+
+// V2EventInput triggers an event
+type V2EventInput struct {
+	Name         string                 `json:"name"`
+	LanguageCode string                 `json:"languageCode,omitempty"`
+	Parameters   map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// V2DetectIntentResponse is the v2 counterpart of model.QueryResponse
+type V2DetectIntentResponse struct {
+	ResponseID    string        `json:"responseId,omitempty"`
+	QueryResult   V2QueryResult `json:"queryResult"`
+	WebhookStatus *V2Status     `json:"webhookStatus,omitempty"`
+}
+
+// V2Status is a v2 error status
+type V2Status struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+// grpcCodes maps HTTP statuses to the gRPC codes used by v2 statuses
+var grpcCodes = map[int]int{
+	400: 3,  // INVALID_ARGUMENT
+	401: 16, // UNAUTHENTICATED
+	403: 7,  // PERMISSION_DENIED
+	404: 5,  // NOT_FOUND
+	409: 10, // ABORTED
+	429: 8,  // RESOURCE_EXHAUSTED
+	501: 12, // UNIMPLEMENTED
+	503: 14, // UNAVAILABLE
+	504: 4,  // DEADLINE_EXCEEDED
+}
+
+func grpcCode(status int) int {
+	if code, ok := grpcCodes[status]; ok {
+		return code
+	}
+	return 13 // INTERNAL
+}
+
+func httpCode(code int) int {
+	for status, grpc := range grpcCodes {
+		if grpc == code {
+			return status
+		}
+	}
+	return 500
+}
+
+// v2Platforms maps v1 platform names to v2 ones
+var v2Platforms = map[string]string{
+	PlatformFacebook: "FACEBOOK",
+	PlatformSlack:    "SLACK",
+	PlatformTelegram: "TELEGRAM",
+	PlatformKik:      "KIK",
+	PlatformSkype:    "SKYPE",
+	PlatformLine:     "LINE",
+	PlatformViber:    "VIBER",
+	PlatformGoogle:   "ACTIONS_ON_GOOGLE",
+}
+
+func platformToV2(platform string) string {
+	if v2, ok := v2Platforms[platform]; ok {
+		return v2
+	}
+	return strings.ToUpper(platform)
+}
+
+func platformFromV2(platform string) string {
+	for v1, v2 := range v2Platforms {
+		if v2 == platform {
+			return v1
+		}
+	}
+	if platform == "PLATFORM_UNSPECIFIED" {
+		return ""
+	}
+	return strings.ToLower(platform)
+}
+
+// lastSegment returns what follows the last / of path
+func lastSegment(path string) string {
+	return path[strings.LastIndex(path, "/")+1:]
+}
+
+// SessionPath returns the v2 path of a session of the agent of project
+func SessionPath(project, sessionID string) string {
+	return "projects/" + project + "/agent/sessions/" + sessionID
+}
+
+// ContextsToV2 names contexts by their path under the session at sessionPath
+func ContextsToV2(contexts []model.Context, sessionPath string) []V2Context {
+	var v2 []V2Context
+	for _, context := range contexts {
+		v2 = append(v2, V2Context{
+			Name:          sessionPath + "/contexts/" + strings.ToLower(context.Name),
+			LifespanCount: context.Lifespan,
+			Parameters:    context.Parameters,
+		})
+	}
+	return v2
+}
+
+// ContextsFromV2 converts v2 contexts, keeping the last segment of their path as name
+func ContextsFromV2(contexts []V2Context) []model.Context {
+	var v1 []model.Context
+	for _, context := range contexts {
+		v1 = append(v1, model.Context{
+			Name:       lastSegment(context.Name),
+			Lifespan:   context.LifespanCount,
+			Parameters: context.Parameters,
+		})
+	}
+	return v1
+}
+
+// MessagesToV2 converts v1 rich messages
+func MessagesToV2(messages []model.Message) []V2Message {
+	var v2 []V2Message
+	for _, message := range messages {
+		converted := V2Message{Platform: platformToV2(message.Platform)}
+
+		switch message.Type {
+		case model.CardMessage:
+			card := &V2Card{Title: message.Title, Subtitle: message.Subtitle, ImageURI: message.ImageURL}
+			for _, button := range message.Buttons {
+				card.Buttons = append(card.Buttons, V2CardButton{Text: button.Text, Postback: button.Postback})
+			}
+			converted.Card = card
+		case model.QuickRepliesMessage:
+			converted.QuickReplies = &V2QuickReplies{Title: message.Title, QuickReplies: message.Replies}
+		case model.ImageMessage:
+			converted.Image = &V2Image{ImageURI: message.ImageURL}
+		case model.PayloadMessage:
+			converted.Payload = message.Payload
+		default:
+			converted.Text = &V2Text{Text: []string{message.Speech}}
+		}
+
+		v2 = append(v2, converted)
+	}
+	return v2
+}
+
+// MessagesFromV2 converts v2 rich messages
+// Text messages with several variants become one v1 message per variant
+func MessagesFromV2(messages []V2Message) []model.Message {
+	var v1 []model.Message
+	for _, message := range messages {
+		converted := model.Message{Platform: platformFromV2(message.Platform)}
+
+		switch {
+		case message.Card != nil:
+			converted.Type = model.CardMessage
+			converted.Title, converted.Subtitle, converted.ImageURL = message.Card.Title, message.Card.Subtitle, message.Card.ImageURI
+			for _, button := range message.Card.Buttons {
+				converted.Buttons = append(converted.Buttons, model.Button{Text: button.Text, Postback: button.Postback})
+			}
+		case message.QuickReplies != nil:
+			converted.Type = model.QuickRepliesMessage
+			converted.Title, converted.Replies = message.QuickReplies.Title, message.QuickReplies.QuickReplies
+		case message.Image != nil:
+			converted.Type = model.ImageMessage
+			converted.ImageURL = message.Image.ImageURI
+		case message.Payload != nil:
+			converted.Type = model.PayloadMessage
+			converted.Payload = message.Payload
+		case message.Text != nil:
+			for _, text := range message.Text.Text {
+				v1 = append(v1, model.Message{Type: model.TextMessage, Platform: converted.Platform, Speech: text})
+			}
+			continue
+		default:
+			continue
+		}
+
+		v1 = append(v1, converted)
+	}
+	return v1
+}
+
+// ResultToV2 converts a v1 query result, for the session at sessionPath
+func ResultToV2(result model.Result, lang, sessionPath string) V2QueryResult {
+	v2 := V2QueryResult{
+		QueryText:                 result.ResolvedQuery,
+		LanguageCode:              lang,
+		Action:                    result.Action,
+		Parameters:                result.Parameters,
+		AllRequiredParamsPresent:  !result.ActionIncomplete,
+		FulfillmentText:           result.Fulfillment.Speech,
+		FulfillmentMessages:       MessagesToV2(result.Fulfillment.Messages),
+		OutputContexts:            ContextsToV2(result.Contexts, sessionPath),
+		IntentDetectionConfidence: result.Score,
+	}
+
+	if result.Metadata.IntentID != "" || result.Metadata.IntentName != "" {
+		v2.Intent = &V2Intent{DisplayName: result.Metadata.IntentName}
+		if result.Metadata.IntentID != "" {
+			v2.Intent.Name = projectPath(sessionPath) + "/agent/intents/" + result.Metadata.IntentID
+		}
+	}
+	return v2
+}
+
+// projectPath returns projects/<project> from a session path
+func projectPath(sessionPath string) string {
+	parts := strings.SplitN(sessionPath, "/", 3)
+	if len(parts) < 2 {
+		return sessionPath
+	}
+	return parts[0] + "/" + parts[1]
+}
+
+// ResultFromV2 converts a v2 query result
+func ResultFromV2(result V2QueryResult) model.Result {
+	v1 := model.Result{
+		Source:           "agent",
+		Action:           result.Action,
+		ResolvedQuery:    result.QueryText,
+		ActionIncomplete: !result.AllRequiredParamsPresent,
+		Parameters:       result.Parameters,
+		Contexts:         ContextsFromV2(result.OutputContexts),
+		Fulfillment: model.Fulfillment{
+			Speech:   result.FulfillmentText,
+			Messages: MessagesFromV2(result.FulfillmentMessages),
+		},
+		Score: result.IntentDetectionConfidence,
+	}
+
+	if result.Intent != nil {
+		v1.Metadata.IntentName = result.Intent.DisplayName
+		if result.Intent.Name != "" {
+			v1.Metadata.IntentID = lastSegment(result.Intent.Name)
+		}
+	}
+	return v1
+}
+
+// RequestToV2 converts a v1 webhook request for the agent of project
+func RequestToV2(request *Request, project string) V2Request {
+	sessionPath := SessionPath(project, request.SessionID)
+
+	v2 := V2Request{
+		ResponseID:  request.ID,
+		Session:     sessionPath,
+		QueryResult: ResultToV2(request.Result, request.Lang, sessionPath),
+	}
+
+	if original := request.OriginalRequest; original != nil {
+		v2.OriginalDetectIntentRequest = &V2OriginalRequest{Source: original.Source, Version: original.Version}
+		if len(original.Data) > 0 {
+			payload := make(map[string]interface{})
+			if json.Unmarshal(original.Data, &payload) == nil {
+				v2.OriginalDetectIntentRequest.Payload = payload
+			}
+		}
+	}
+	return v2
+}
+
+// RequestFromV2 converts a v2 webhook request
+func RequestFromV2(request V2Request) (*Request, error) {
+	v1 := &Request{
+		ID:        request.ResponseID,
+		Lang:      request.QueryResult.LanguageCode,
+		Result:    ResultFromV2(request.QueryResult),
+		Status:    model.Status{Code: 200, ErrorType: "success"},
+		SessionID: lastSegment(request.Session),
+	}
+
+	if original := request.OriginalDetectIntentRequest; original != nil {
+		v1.OriginalRequest = &OriginalRequest{Source: original.Source, Version: original.Version}
+		if original.Payload != nil {
+			data, err := json.Marshal(original.Payload)
+			if err != nil {
+				return nil, err
+			}
+			v1.OriginalRequest.Data = data
+		}
+	}
+	return v1, nil
+}
+
+// ResponseToV2 converts a v1 webhook response to a request of the session at sessionPath
+func ResponseToV2(response *Response, lang, sessionPath string) V2Response {
+	v2 := V2Response{
+		FulfillmentText:     response.Speech,
+		FulfillmentMessages: MessagesToV2(response.Messages),
+		Source:              response.Source,
+		Payload:             response.Data,
+		OutputContexts:      ContextsToV2(response.ContextOut, sessionPath),
+	}
+	if v2.FulfillmentText == "" {
+		v2.FulfillmentText = response.DisplayText
+	}
+
+	if event := response.FollowupEvent; event != nil {
+		v2.FollowupEventInput = &V2EventInput{Name: event.Name, LanguageCode: lang}
+		if len(event.Data) > 0 {
+			v2.FollowupEventInput.Parameters = make(map[string]interface{}, len(event.Data))
+			for name, value := range event.Data {
+				v2.FollowupEventInput.Parameters[name] = value
+			}
+		}
+	}
+	return v2
+}
+
+// ResponseFromV2 converts a v2 webhook response
+// Event parameters that are not strings are dropped, as v1 events only carry strings
+func ResponseFromV2(response V2Response) *Response {
+	v1 := &Response{
+		Speech:      response.FulfillmentText,
+		DisplayText: response.FulfillmentText,
+		Messages:    MessagesFromV2(response.FulfillmentMessages),
+		Data:        response.Payload,
+		ContextOut:  ContextsFromV2(response.OutputContexts),
+		Source:      response.Source,
+	}
+
+	if event := response.FollowupEventInput; event != nil {
+		v1.FollowupEvent = &model.Event{Name: event.Name}
+		for name, value := range event.Parameters {
+			if s, ok := value.(string); ok {
+				if v1.FollowupEvent.Data == nil {
+					v1.FollowupEvent.Data = make(map[string]string)
+				}
+				v1.FollowupEvent.Data[name] = s
+			}
+		}
+	}
+	return v1
+}
+
+// QueryResponseToV2 converts a v1 query response of the agent of project
+func QueryResponseToV2(response model.QueryResponse, project string) V2DetectIntentResponse {
+	v2 := V2DetectIntentResponse{
+		ResponseID:  response.ID,
+		QueryResult: ResultToV2(response.Result, response.Lang, SessionPath(project, response.SessionID)),
+	}
+	if response.Status.Code >= 400 {
+		v2.WebhookStatus = &V2Status{Code: grpcCode(response.Status.Code), Message: response.Status.ErrorDetails}
+	}
+	return v2
+}
+
+// QueryResponseFromV2 converts a v2 detect intent response of the session at sessionPath
+func QueryResponseFromV2(response V2DetectIntentResponse, sessionPath string) model.QueryResponse {
+	v1 := model.QueryResponse{
+		ID:        response.ResponseID,
+		Result:    ResultFromV2(response.QueryResult),
+		Status:    model.Status{Code: 200, ErrorType: "success"},
+		SessionID: lastSegment(sessionPath),
+		Lang:      response.QueryResult.LanguageCode,
+	}
+	if status := response.WebhookStatus; status != nil && status.Code != 0 {
+		v1.Status = model.Status{Code: httpCode(status.Code), ErrorType: "webhook_error", ErrorDetails: status.Message}
+	}
+	return v1
+}
@@ -0,0 +1,313 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+func TestRequestRoundTrip(t *testing.T) {
+	request := &Request{
+		ID:   "response-1",
+		Lang: "en",
+		Result: model.Result{
+			Source:           "agent",
+			Action:           "book.table",
+			ResolvedQuery:    "book a table for two",
+			ActionIncomplete: true,
+			Parameters:       map[string]interface{}{"guests": "2"},
+			Contexts: []model.Context{
+				{Name: "booking", Lifespan: 5, Parameters: map[string]interface{}{"guests": "2"}},
+				{Name: "expired", Lifespan: 0},
+			},
+			Metadata: model.Metadata{IntentID: "intent-1", IntentName: "Book table"},
+			Fulfillment: model.Fulfillment{
+				Speech: "For when?",
+				Messages: []model.Message{
+					{Type: model.TextMessage, Speech: "For when?"},
+					{Type: model.QuickRepliesMessage, Platform: PlatformFacebook, Title: "When?", Replies: []string{"Tonight", "Tomorrow"}},
+				},
+			},
+			Score: 0.75,
+		},
+		Status:    model.Status{Code: 200, ErrorType: "success"},
+		SessionID: "session-1",
+		OriginalRequest: &OriginalRequest{
+			Source:  "google",
+			Version: "2",
+			Data:    json.RawMessage(`{"isInSandbox":true}`),
+		},
+	}
+
+	v2 := RequestToV2(request, "project-1")
+	if v2.Session != "projects/project-1/agent/sessions/session-1" {
+		t.Errorf("got session %q", v2.Session)
+	}
+	if v2.QueryResult.Intent == nil || v2.QueryResult.Intent.Name != "projects/project-1/agent/intents/intent-1" {
+		t.Errorf("got intent %+v", v2.QueryResult.Intent)
+	}
+	if name := v2.QueryResult.OutputContexts[0].Name; name != "projects/project-1/agent/sessions/session-1/contexts/booking" {
+		t.Errorf("got context %q", name)
+	}
+
+	back, err := RequestFromV2(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, request) {
+		t.Errorf("round trip changed the request\ngot  %+v\nwant %+v", back, request)
+	}
+}
+
+func TestV2RequestRoundTrip(t *testing.T) {
+	session := "projects/project-1/agent/sessions/session-1"
+	v2 := V2Request{
+		ResponseID: "response-1",
+		Session:    session,
+		QueryResult: V2QueryResult{
+			QueryText:                "hi",
+			LanguageCode:             "en-us",
+			Action:                   "greet",
+			Parameters:               map[string]interface{}{"name": "Ada"},
+			AllRequiredParamsPresent: true,
+			FulfillmentText:          "Hello",
+			FulfillmentMessages: []V2Message{
+				{Platform: "FACEBOOK", Text: &V2Text{Text: []string{"Hello"}}},
+				{Platform: "SLACK", Card: &V2Card{Title: "Menu", ImageURI: "https://example.com/menu.png", Buttons: []V2CardButton{{Text: "Open", Postback: "open"}}}},
+				{Image: &V2Image{ImageURI: "https://example.com/logo.png"}},
+				{Payload: map[string]interface{}{"custom": true}},
+			},
+			OutputContexts: []V2Context{
+				{Name: session + "/contexts/greeted", LifespanCount: 2},
+			},
+			Intent:                    &V2Intent{Name: "projects/project-1/agent/intents/intent-1", DisplayName: "Greet"},
+			IntentDetectionConfidence: 1,
+		},
+		OriginalDetectIntentRequest: &V2OriginalRequest{Source: "slack", Payload: map[string]interface{}{"user": "U1"}},
+	}
+
+	request, err := RequestFromV2(v2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if request.SessionID != "session-1" || request.Result.Metadata.IntentID != "intent-1" {
+		t.Errorf("got session %q and intent %q", request.SessionID, request.Result.Metadata.IntentID)
+	}
+	if request.Result.Fulfillment.Messages[0].Platform != PlatformFacebook {
+		t.Errorf("got platform %q", request.Result.Fulfillment.Messages[0].Platform)
+	}
+
+	back := RequestToV2(request, "project-1")
+	if !reflect.DeepEqual(back, v2) {
+		t.Errorf("round trip changed the request\ngot  %+v\nwant %+v", back, v2)
+	}
+}
+
+func TestResponseRoundTrip(t *testing.T) {
+	session := "projects/project-1/agent/sessions/session-1"
+	response := &Response{
+		Speech:      "Booked",
+		DisplayText: "Booked",
+		Messages: []model.Message{
+			{Type: model.TextMessage, Speech: "Booked"},
+			{Type: model.CardMessage, Platform: PlatformTelegram, Title: "Table", Subtitle: "for two", Buttons: []model.Button{{Text: "Cancel", Postback: "cancel"}}},
+		},
+		Data:          map[string]interface{}{"id": "42"},
+		ContextOut:    []model.Context{{Name: "booking", Lifespan: 5}, {Name: "prompt", Lifespan: 0}},
+		FollowupEvent: &model.Event{Name: "booked", Data: map[string]string{"id": "42"}},
+		Source:        "webhook",
+	}
+
+	v2 := ResponseToV2(response, "en", session)
+	if v2.FollowupEventInput == nil || v2.FollowupEventInput.LanguageCode != "en" {
+		t.Errorf("got followup event %+v", v2.FollowupEventInput)
+	}
+
+	back := ResponseFromV2(v2)
+	if !reflect.DeepEqual(back, response) {
+		t.Errorf("round trip changed the response\ngot  %+v\nwant %+v", back, response)
+	}
+}
+
+func TestV2ResponseRoundTrip(t *testing.T) {
+	session := "projects/project-1/agent/sessions/session-1"
+	v2 := V2Response{
+		FulfillmentText: "Pick one",
+		FulfillmentMessages: []V2Message{
+			{Platform: "FACEBOOK", QuickReplies: &V2QuickReplies{Title: "Pick one", QuickReplies: []string{"A", "B"}}},
+		},
+		Source:             "webhook",
+		Payload:            map[string]interface{}{"google": map[string]interface{}{"expectUserResponse": true}},
+		OutputContexts:     []V2Context{{Name: session + "/contexts/picking", LifespanCount: 1, Parameters: map[string]interface{}{"options": "A,B"}}},
+		FollowupEventInput: &V2EventInput{Name: "picked", LanguageCode: "en", Parameters: map[string]interface{}{"choice": "A"}},
+	}
+
+	back := ResponseToV2(ResponseFromV2(v2), "en", session)
+	if !reflect.DeepEqual(back, v2) {
+		t.Errorf("round trip changed the response\ngot  %+v\nwant %+v", back, v2)
+	}
+}
+
+func TestResponseFromV2DropsNonStringEventParameters(t *testing.T) {
+	response := ResponseFromV2(V2Response{
+		FollowupEventInput: &V2EventInput{Name: "e", Parameters: map[string]interface{}{"n": 1.0, "s": "x"}},
+	})
+
+	if want := map[string]string{"s": "x"}; !reflect.DeepEqual(response.FollowupEvent.Data, want) {
+		t.Errorf("got event data %v, want %v", response.FollowupEvent.Data, want)
+	}
+}
+
+func TestMessagesFromV2SplitsTextVariants(t *testing.T) {
+	messages := MessagesFromV2([]V2Message{
+		{Platform: "PLATFORM_UNSPECIFIED", Text: &V2Text{Text: []string{"Hi", "Hello"}}},
+		{},
+	})
+
+	want := []model.Message{
+		{Type: model.TextMessage, Speech: "Hi"},
+		{Type: model.TextMessage, Speech: "Hello"},
+	}
+	if !reflect.DeepEqual(messages, want) {
+		t.Errorf("got %+v, want %+v", messages, want)
+	}
+}
+
+func TestQueryResponseRoundTrip(t *testing.T) {
+	tests := []struct {
+		status model.Status
+		grpc   int
+	}{
+		{model.Status{Code: 200, ErrorType: "success"}, 0},
+		{model.Status{Code: 404, ErrorType: "webhook_error", ErrorDetails: "not found"}, 5},
+		{model.Status{Code: 504, ErrorType: "webhook_error", ErrorDetails: "timed out"}, 4},
+		{model.Status{Code: 500, ErrorType: "webhook_error", ErrorDetails: "failed"}, 13},
+	}
+
+	for _, test := range tests {
+		response := model.QueryResponse{
+			ID:        "response-1",
+			SessionID: "session-1",
+			Lang:      "en",
+			Result: model.Result{
+				Source:        "agent",
+				ResolvedQuery: "hi",
+				Metadata:      model.Metadata{IntentID: "intent-1", IntentName: "Greet"},
+				Fulfillment:   model.Fulfillment{Speech: "Hello"},
+			},
+			Status: test.status,
+		}
+
+		v2 := QueryResponseToV2(response, "project-1")
+		if test.grpc == 0 && v2.WebhookStatus != nil || test.grpc != 0 && (v2.WebhookStatus == nil || v2.WebhookStatus.Code != test.grpc) {
+			t.Errorf("status %d: got webhook status %+v, want code %d", test.status.Code, v2.WebhookStatus, test.grpc)
+		}
+
+		back := QueryResponseFromV2(v2, SessionPath("project-1", "session-1"))
+		if !reflect.DeepEqual(back, response) {
+			t.Errorf("status %d: round trip changed the query response\ngot  %+v\nwant %+v", test.status.Code, back, response)
+		}
+	}
+}
+
+func TestNewHandlerServesV2(t *testing.T) {
+	handler := NewHandler(HandlerFunc(func(ctx context.Context, request *Request) (*Response, error) {
+		if request.SessionID != "session-1" || request.Result.Action != "greet" {
+			t.Errorf("got session %q and action %q", request.SessionID, request.Result.Action)
+		}
+		return NewBuilder().Text("Hello").Context("greeting", 0, nil).WebhookResponse()
+	}))
+
+	body := `{
+		"responseId": "response-1",
+		"session": "projects/project-1/agent/sessions/session-1",
+		"queryResult": {"queryText": "hi", "action": "greet", "languageCode": "en"}
+	}`
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("got status %d: %s", w.Code, w.Body)
+	}
+
+	var response map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response["fulfillmentText"] != "Hello" {
+		t.Errorf("got fulfillment text %v", response["fulfillmentText"])
+	}
+
+	contexts, _ := response["outputContexts"].([]interface{})
+	if len(contexts) != 1 {
+		t.Fatalf("got output contexts %v", response["outputContexts"])
+	}
+	want := map[string]interface{}{
+		"name":          "projects/project-1/agent/sessions/session-1/contexts/greeting",
+		"lifespanCount": 0.0,
+	}
+	if !reflect.DeepEqual(contexts[0], want) {
+		t.Errorf("got output context %v, want %v", contexts[0], want)
+	}
+}
+
+func TestNewHandlerServesV2Errors(t *testing.T) {
+	handler := NewHandler(HandlerFunc(func(ctx context.Context, request *Request) (*Response, error) {
+		return nil, &Error{Code: http.StatusNotFound, Message: "no such booking"}
+	}))
+
+	tests := []struct {
+		name string
+		body string
+		code int
+		want V2Status
+	}{
+		{
+			name: "handler error",
+			body: `{"session": "projects/project-1/agent/sessions/session-1", "queryResult": {"queryText": "hi"}}`,
+			code: http.StatusNotFound,
+			want: V2Status{Code: 5, Message: "no such booking"},
+		},
+		{
+			name: "request without a session",
+			body: `{"queryResult": {"queryText": "hi"}}`,
+			code: http.StatusBadRequest,
+			want: V2Status{Code: 3, Message: "invalid webhook request: v2 request has no session"},
+		},
+	}
+
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(test.body)))
+
+		if w.Code != test.code {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.code)
+		}
+		var body map[string]json.RawMessage
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := body["status"]; ok {
+			t.Errorf("%s: got a v1 status in %s", test.name, w.Body)
+		}
+		var status V2Status
+		json.Unmarshal(body["webhookStatus"], &status)
+		if status != test.want {
+			t.Errorf("%s: got webhook status %+v, want %+v", test.name, status, test.want)
+		}
+	}
+
+	// v1 requests keep their DialogFlow status
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"sessionId": "session-1"}`)))
+	var v1 errorBody
+	if err := json.Unmarshal(w.Body.Bytes(), &v1); err != nil || v1.Status.Code != http.StatusNotFound {
+		t.Errorf("v1: got %s", w.Body)
+	}
+}
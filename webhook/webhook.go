@@ -0,0 +1,224 @@
+// Package webhook implements fulfillment servers for the DialogFlow v1 webhook protocol,
+// and translates v2 webhook payloads to and from it
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/kompiuter/go-dialogflow/model"
+)
+
+// maxBodySize caps the size of webhook requests
+const maxBodySize = 1 << 20
+
+// Request is the body of a webhook call
+type Request struct {
+	ID              string           `json:"id,omitempty"`
+	Timestamp       time.Time        `json:"timestamp,omitempty"`
+	Lang            string           `json:"lang,omitempty"`
+	Result          model.Result     `json:"result"`
+	Status          model.Status     `json:"status,omitempty"`
+	SessionID       string           `json:"sessionId,omitempty"`
+	OriginalRequest *OriginalRequest `json:"originalRequest,omitempty"`
+}
+
+// OriginalRequest is the request received by DialogFlow from an integration, e.g. Google Assistant
+type OriginalRequest struct {
+	Source  string          `json:"source,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+// Context returns the active context called name, ignoring case
+func (request *Request) Context(name string) (model.Context, bool) {
+	for _, context := range request.Result.Contexts {
+		if strings.EqualFold(context.Name, name) {
+			return context, true
+		}
+	}
+	return model.Context{}, false
+}
+
+// Response is the body of a webhook reply
+// Output contexts always carry their lifespan, a lifespan of 0 removes the context
+type Response struct {
+	Speech        string                 `json:"speech,omitempty"`
+	DisplayText   string                 `json:"displayText,omitempty"`
+	Messages      []model.Message        `json:"messages,omitempty"`
+	Data          map[string]interface{} `json:"data,omitempty"`
+	ContextOut    []model.Context        `json:"contextOut,omitempty"`
+	FollowupEvent *model.Event           `json:"followupEvent,omitempty"`
+	Source        string                 `json:"source,omitempty"`
+}
+
+// outputContext is a context of a response, whose lifespan is always encoded since 0 removes it
+type outputContext struct {
+	Name       string                 `json:"name,omitempty"`
+	Lifespan   int                    `json:"lifespan"`
+	Parameters map[string]interface{} `json:"parameters,omitempty"`
+}
+
+// MarshalJSON encodes response, with an explicit lifespan for every output context
+func (response Response) MarshalJSON() ([]byte, error) {
+	type plain Response
+	encoded := struct {
+		plain
+		ContextOut []outputContext `json:"contextOut,omitempty"`
+	}{plain: plain(response)}
+
+	for _, context := range response.ContextOut {
+		encoded.ContextOut = append(encoded.ContextOut, outputContext(context))
+	}
+
+	return json.Marshal(encoded)
+}
+
+// Handler fulfills webhook requests
+type Handler interface {
+	ServeWebhook(ctx context.Context, request *Request) (*Response, error)
+}
+
+// HandlerFunc adapts a function to a Handler
+type HandlerFunc func(ctx context.Context, request *Request) (*Response, error)
+
+// ServeWebhook calls fn
+func (fn HandlerFunc) ServeWebhook(ctx context.Context, request *Request) (*Response, error) {
+	return fn(ctx, request)
+}
+
+// Error is an error that is reported to DialogFlow with a specific HTTP status
+type Error struct {
+	Code    int
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// errorBody is the body of a failed webhook reply, shaped like a DialogFlow status
+type errorBody struct {
+	Status model.Status `json:"status"`
+}
+
+// writeError replies with code and a DialogFlow status describing message
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(errorBody{Status: model.Status{
+		Code:         code,
+		ErrorType:    strings.ToLower(strings.ReplaceAll(http.StatusText(code), " ", "_")),
+		ErrorDetails: message,
+	}})
+}
+
+// v2ErrorBody is the body of a failed reply to a v2 request
+type v2ErrorBody struct {
+	WebhookStatus V2Status `json:"webhookStatus"`
+}
+
+// writeV2Error replies with code and a v2 status describing message
+func writeV2Error(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v2ErrorBody{WebhookStatus: V2Status{Code: grpcCode(code), Message: message}})
+}
+
+// writeJSON replies with v encoded as JSON
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("webhook: could not write response: %v", err)
+	}
+}
+
+// NewHandler creates an http.Handler that decodes webhook requests, passes them to handler
+// and encodes its responses
+// It also serves v2 requests, translating them to v1 and the responses back to v2
+// Errors are reported with status 500, unless they are an *Error
+// Errors of v2 requests are reported with a v2 status instead of a DialogFlow one
+func NewHandler(handler Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			writeError(w, http.StatusMethodNotAllowed, "webhook requests must be POST")
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid webhook request: "+err.Error())
+			return
+		}
+
+		fail := writeError
+		if isV2(body) {
+			fail = writeV2Error
+		}
+
+		request, session, err := decodeRequest(body)
+		if err != nil {
+			fail(w, http.StatusBadRequest, "invalid webhook request: "+err.Error())
+			return
+		}
+
+		response, err := handler.ServeWebhook(r.Context(), request)
+		if err != nil {
+			var webhookErr *Error
+			if errors.As(err, &webhookErr) {
+				fail(w, webhookErr.Code, webhookErr.Message)
+				return
+			}
+			log.Printf("webhook: action %q failed: %v", request.Result.Action, err)
+			fail(w, http.StatusInternalServerError, "fulfillment failed")
+			return
+		}
+
+		if response == nil {
+			response = &Response{}
+		}
+		if session != "" {
+			writeJSON(w, ResponseToV2(response, request.Lang, session))
+			return
+		}
+		writeJSON(w, response)
+	})
+}
+
+// decodeRequest decodes a v1 or v2 webhook request, telling them apart by their fields
+// For v2 requests it also returns the session path, which v2 responses need
+func decodeRequest(body []byte) (*Request, string, error) {
+	if !isV2(body) {
+		var request Request
+		if err := json.Unmarshal(body, &request); err != nil {
+			return nil, "", err
+		}
+		return &request, "", nil
+	}
+
+	var v2 V2Request
+	if err := json.Unmarshal(body, &v2); err != nil {
+		return nil, "", err
+	}
+	if v2.Session == "" {
+		return nil, "", errors.New("v2 request has no session")
+	}
+
+	request, err := RequestFromV2(v2)
+	return request, v2.Session, err
+}
+
+// isV2 reports whether body is a v2 request, which unlike v1 ones has a queryResult
+func isV2(body []byte) bool {
+	var probe struct {
+		QueryResult json.RawMessage `json:"queryResult"`
+	}
+	return json.Unmarshal(body, &probe) == nil && probe.QueryResult != nil
+}